@@ -0,0 +1,183 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"backend/config"
+	"backend/decoder"
+	"backend/store"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	notificationQueueSize = 1000
+	webhookTimeout        = 10 * time.Second
+	maxWebhookRetryDelay  = time.Minute
+)
+
+type notification struct {
+	rule  *rule
+	event Event
+}
+
+// Alerter evaluates the alert rules on the inserted messages and delivers the notifications to the rule webhooks.
+// Messages older than the max lag, e.g. consumed from the beginning of a topic, don't fire rules.
+type Alerter struct {
+	configure     *config.Configure     `di.inject:"appConfigure"`
+	storeSvc      *store.RethinkService `di.inject:"storeService"`
+	decoderSvc    *decoder.Decoder      `di.inject:"decoderService"`
+	rules         []*rule
+	mutex         sync.Mutex
+	notifications chan notification
+	client        *http.Client
+}
+
+func (alerter *Alerter) Serve() {
+	var (
+		config = alerter.configure.Config
+		err    error
+	)
+
+	if config.AlertRules == "" {
+		return
+	}
+
+	if alerter.rules, err = loadRules(config.AlertRules, alerter.decoderSvc, config.HeaderBinaryEncoding); err != nil {
+		log.Errorf("Alert: load rules error: %s", err.Error())
+		return
+	}
+
+	alerter.client = &http.Client{Timeout: webhookTimeout}
+	alerter.notifications = make(chan notification, notificationQueueSize)
+	go alerter.deliver()
+
+	alerter.storeSvc.AddListener(alerter)
+	log.Infof("Alert: %d rules loaded from %s", len(alerter.rules), config.AlertRules)
+}
+
+func (alerter *Alerter) Stop(ctx context.Context) {
+}
+
+// Stored evaluates the rules on the inserted messages.
+func (alerter *Alerter) Stored(batch []store.Consumed) {
+	var now = time.Now()
+
+	alerter.mutex.Lock()
+	defer alerter.mutex.Unlock()
+
+	for i := range batch {
+		message := &batch[i]
+		if now.Sub(message.At) > alerter.configure.Config.AlertMaxLag {
+			continue
+		}
+
+		for _, rule := range alerter.rules {
+			count, fired := rule.match(message.Message, now)
+			if !fired {
+				continue
+			}
+
+			key, _ := store.Render(message.Key)
+			event := Event{
+				Rule:      rule.name,
+				Topic:     message.Topic,
+				Partition: message.Partition,
+				Offset:    message.Offset,
+				At:        message.At,
+				Key:       key,
+				Payload:   alerter.decoderSvc.DecodeOnce(message).Value,
+				Count:     count,
+				Window:    rule.window.String(),
+			}
+
+			select {
+			case alerter.notifications <- notification{rule: rule, event: event}:
+			default:
+				log.Warnf("Alert: notification queue is full, drop the notification of rule '%s'", rule.name)
+			}
+		}
+	}
+}
+
+func (alerter *Alerter) deliver() {
+	for {
+		select {
+		case <-alerter.configure.GlobalContext.Done():
+			return
+
+		case notification := <-alerter.notifications:
+			alerter.send(notification)
+		}
+	}
+}
+
+// send posts the notification to the webhook and retries with the exponential delay.
+func (alerter *Alerter) send(notification notification) {
+	var (
+		body    bytes.Buffer
+		rule    = notification.rule
+		retries = alerter.configure.Config.AlertRetries
+	)
+
+	if err := rule.body.Execute(&body, notification.event); err != nil {
+		log.Errorf("Alert: rule '%s' body template error: %s", rule.name, err.Error())
+		return
+	}
+
+	delay := time.Second
+	for attempt := 0; ; attempt++ {
+		err := alerter.post(alerter.configure.GlobalContext, rule, body.Bytes())
+		if err == nil {
+			log.Infof("Alert: rule '%s' fired for %s/%d/%d", rule.name, notification.event.Topic, notification.event.Partition, notification.event.Offset)
+			return
+		}
+
+		if attempt >= retries {
+			log.Errorf("Alert: rule '%s' webhook error after %d attempts: %s", rule.name, attempt+1, err.Error())
+			return
+		}
+
+		log.Warnf("Alert: rule '%s' webhook error: %s. Retry in %s", rule.name, err.Error(), delay)
+		select {
+		case <-alerter.configure.GlobalContext.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		if delay *= 2; delay > maxWebhookRetryDelay {
+			delay = maxWebhookRetryDelay
+		}
+	}
+}
+
+func (alerter *Alerter) post(ctx context.Context, rule *rule, body []byte) error {
+	request, err := http.NewRequestWithContext(ctx, rule.method, rule.webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range rule.headers {
+		request.Header.Set(key, value)
+	}
+
+	response, err := alerter.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, response.Body)
+
+	if response.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("webhook status %s", response.Status)
+	}
+	return nil
+}
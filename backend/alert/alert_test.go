@@ -0,0 +1,114 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend/config"
+	"backend/decoder"
+	"backend/store"
+)
+
+func TestAlerterWebhook(t *testing.T) {
+	var events = make(chan map[string]interface{}, 10)
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := ioutil.ReadAll(request.Body)
+
+		var event map[string]interface{}
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Errorf("webhook body %s: %s", body, err.Error())
+		}
+
+		if got := request.Header.Get("Authorization"); got != "Bearer token" {
+			t.Errorf("authorization header: got %q", got)
+		}
+		events <- event
+	}))
+	defer server.Close()
+
+	orderErrors, err := newRule(RuleConfig{
+		Name:      "order-errors",
+		Topic:     "^orders$",
+		Filters:   []FilterConfig{{Param: "status", Operator: store.OperatorEq, Value: "error"}},
+		Threshold: 2,
+		Window:    "1m",
+		Webhook:   server.URL,
+		Headers:   map[string]string{"Authorization": "Bearer token"},
+	}, nil, store.HeaderEncodingBase64)
+	if err != nil {
+		t.Fatalf("new rule: %s", err.Error())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	alerter := &Alerter{
+		configure:     &config.Configure{GlobalContext: ctx, Config: &config.Config{AlertMaxLag: time.Minute}},
+		rules:         []*rule{orderErrors},
+		notifications: make(chan notification, notificationQueueSize),
+		client:        &http.Client{Timeout: webhookTimeout},
+	}
+	go alerter.deliver()
+
+	message := func(offset int, status string) store.Consumed {
+		return store.Consumed{
+			Message: store.Message{
+				Topic:   "orders",
+				Offset:  offset,
+				At:      time.Now(),
+				Headers: []store.Header{{Key: "status", Value: []byte(status)}},
+			},
+			Decoded: decoder.Payload{Value: map[string]interface{}{"id": float64(offset)}},
+		}
+	}
+
+	alerter.Stored([]store.Consumed{message(1, "error"), message(2, "ok"), message(3, "error"), message(4, "error")})
+
+	select {
+	case event := <-events:
+		if event["rule"] != "order-errors" || event["offset"] != float64(3) || event["count"] != float64(2) {
+			t.Fatalf("event: got %v", event)
+		}
+
+		if payload, _ := event["payload"].(map[string]interface{}); payload["id"] != float64(3) {
+			t.Fatalf("event payload: got %v", event["payload"])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not called")
+	}
+
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected event: %v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestNewRule(t *testing.T) {
+	tests := []struct {
+		name   string
+		config RuleConfig
+		valid  bool
+	}{
+		{"any match", RuleConfig{Name: "rule", Webhook: "http://localhost"}, true},
+		{"threshold with window", RuleConfig{Name: "rule", Webhook: "http://localhost", Threshold: 5, Window: "1m"}, true},
+		{"threshold without window", RuleConfig{Name: "rule", Webhook: "http://localhost", Threshold: 5}, false},
+		{"unknown operator", RuleConfig{Name: "rule", Webhook: "http://localhost",
+			Filters: []FilterConfig{{Param: "status", Operator: "like", Value: "error"}}}, false},
+		{"no webhook", RuleConfig{Name: "rule"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := newRule(test.config, nil, store.HeaderEncodingBase64); (err == nil) != test.valid {
+				t.Fatalf("valid: got %v, want %v (%v)", err == nil, test.valid, err)
+			}
+		})
+	}
+}
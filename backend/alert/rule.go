@@ -0,0 +1,180 @@
+package alert
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"text/template"
+	"time"
+
+	"backend/store"
+)
+
+const defaultBody = `{"rule": {{json .Rule}}, "topic": {{json .Topic}}, "partition": {{.Partition}}, "offset": {{.Offset}}, ` +
+	`"at": {{json .At}}, "count": {{.Count}}, "key": {{json .Key}}, "payload": {{json .Payload}}}`
+
+// RuleConfig is a rule in the rules file. Filters have the format of the messages socket command.
+type RuleConfig struct {
+	Name      string            `json:"name"`
+	Topic     string            `json:"topic"`
+	Filters   []FilterConfig    `json:"filters"`
+	Threshold int               `json:"threshold"`
+	Window    string            `json:"window"`
+	Webhook   string            `json:"webhook"`
+	Method    string            `json:"method"`
+	Headers   map[string]string `json:"headers"`
+	Body      string            `json:"body"`
+}
+
+type FilterConfig struct {
+	Param    string `json:"parameter"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+type rule struct {
+	name      string
+	topic     *regexp.Regexp
+	filters   store.Filters
+	threshold int
+	window    time.Duration
+	webhook   string
+	method    string
+	headers   map[string]string
+	body      *template.Template
+	matches   []time.Time
+}
+
+// Event is the data of the body template.
+type Event struct {
+	Rule      string
+	Topic     string
+	Partition int
+	Offset    int
+	At        time.Time
+	Key       string
+	Payload   interface{}
+	Count     int
+	Window    string
+}
+
+func loadRules(path string, decoder store.PayloadDecoder, headerEncoding string) ([]*rule, error) {
+	var configs []RuleConfig
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(content, &configs); err != nil {
+		return nil, fmt.Errorf("alert rules %s: %w", path, err)
+	}
+
+	rules := make([]*rule, 0, len(configs))
+	for _, config := range configs {
+		rule, err := newRule(config, decoder, headerEncoding)
+		if err != nil {
+			return nil, fmt.Errorf("alert rule '%s': %w", config.Name, err)
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+func newRule(config RuleConfig, decoder store.PayloadDecoder, headerEncoding string) (*rule, error) {
+	var (
+		result = &rule{
+			name:      config.Name,
+			threshold: config.Threshold,
+			webhook:   config.Webhook,
+			method:    config.Method,
+			headers:   config.Headers,
+		}
+		err error
+	)
+
+	if config.Name == "" || config.Webhook == "" {
+		return nil, fmt.Errorf("name and webhook are required")
+	}
+
+	if result.topic, err = regexp.Compile(config.Topic); err != nil {
+		return nil, err
+	}
+
+	if config.Window != "" {
+		if result.window, err = time.ParseDuration(config.Window); err != nil {
+			return nil, err
+		}
+	}
+
+	if result.threshold <= 0 {
+		result.threshold = 1
+	}
+
+	if result.threshold > 1 && result.window <= 0 {
+		return nil, fmt.Errorf("threshold requires window")
+	}
+
+	if result.method == "" {
+		result.method = "POST"
+	}
+
+	body := config.Body
+	if body == "" {
+		body = defaultBody
+	}
+
+	if result.body, err = template.New(config.Name).Funcs(template.FuncMap{"json": toJson}).Parse(body); err != nil {
+		return nil, err
+	}
+
+	params := make([]store.FilterParam, 0, len(config.Filters))
+	for _, filter := range config.Filters {
+		switch filter.Operator {
+		case store.OperatorEq, store.OperatorNe, store.OperatorGt, store.OperatorGe, store.OperatorLt, store.OperatorLe:
+		default:
+			return nil, fmt.Errorf("filter '%s': unknown operator '%s'", filter.Param, filter.Operator)
+		}
+		params = append(params, store.FilterParam{Param: filter.Param, Operator: filter.Operator, Value: filter.Value})
+	}
+
+	result.filters = store.NewFilters(params, decoder, headerEncoding)
+	return result, nil
+}
+
+// match reports whether the message matches the rule and the threshold is reached: any match without the window
+// or the threshold count of matches within the window. The window starts again after the rule fires. The threshold
+// without the window is rejected by newRule.
+func (rule *rule) match(message store.Message, now time.Time) (int, bool) {
+	if !rule.topic.MatchString(message.Topic) {
+		return 0, false
+	}
+
+	if len(rule.filters.Filters) > 0 || rule.filters.Topic != "" {
+		if !message.Filter(rule.filters) {
+			return 0, false
+		}
+	}
+
+	if rule.window <= 0 {
+		return 1, true
+	}
+
+	rule.matches = append(rule.matches, now)
+	for len(rule.matches) > 0 && now.Sub(rule.matches[0]) > rule.window {
+		rule.matches = rule.matches[1:]
+	}
+
+	if count := len(rule.matches); count >= rule.threshold {
+		rule.matches = nil
+		return count, true
+	}
+	return 0, false
+}
+
+func toJson(value interface{}) (string, error) {
+	body, err := json.Marshal(value)
+	return string(body), err
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/goioc/di"
 	log "github.com/sirupsen/logrus"
@@ -12,17 +13,22 @@ import (
 
 type Service interface {
 	Serve()
-	Stop()
+	// Stop releases the service resources, it returns when the context deadline is exceeded at the latest
+	Stop(ctx context.Context)
 }
 
 type Application struct {
-	cancel   context.CancelFunc
-	services []Service
+	cancel          context.CancelFunc
+	shutdownTimeout time.Duration
+	services        []Service
 }
 
-func New(cancel context.CancelFunc, serviceName ...string) *Application {
+// New creates the application of the services in the start order, they are stopped in the reverse order within the
+// shutdown timeout.
+func New(cancel context.CancelFunc, shutdownTimeout time.Duration, serviceName ...string) *Application {
 	application := Application{
-		cancel: cancel,
+		cancel:          cancel,
+		shutdownTimeout: shutdownTimeout,
 	}
 	for _, value := range serviceName {
 		application.services = append(application.services, di.GetInstance(value).(Service))
@@ -40,8 +46,16 @@ func (application *Application) Run() error {
 }
 
 func (application *Application) Stop() {
-	for _, service := range application.services {
-		service.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), application.shutdownTimeout)
+	defer cancel()
+
+	// a service is stopped before the services it depends on
+	for i := len(application.services) - 1; i >= 0; i-- {
+		application.services[i].Stop(ctx)
+	}
+
+	if ctx.Err() != nil {
+		log.Warnf("Shutdown timeout %s is exceeded", application.shutdownTimeout)
 	}
 }
 
@@ -55,8 +69,8 @@ func (application *Application) waitTerminate() error {
 	log.Infof("Wait terminate signal")
 	log.Infof("Signal: %s", (<-stopChan).String())
 
-	application.cancel()
 	application.Stop()
+	application.cancel()
 
 	signal.Stop(stopChan)
 	close(stopChan)
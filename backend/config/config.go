@@ -3,6 +3,10 @@ package config
 import (
 	"context"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/heetch/confita/backend/env"
 
 	"github.com/heetch/confita"
@@ -15,8 +19,43 @@ type Config struct {
 	KafkaHost     string `config:"kafka-host"`
 	KafkaPort     string `config:"kafka-port"`
 	KafkaGroup    string `config:"kafka-group-id"`
+	KafkaVersion  string `config:"kafka-version"`
+	KafkaCluster  string `config:"kafka-cluster"`
 	DatabaseHost  string `config:"db-host"`
 	DatabasePort  string `config:"db-port"`
+
+	GroupsRefreshInterval time.Duration `config:"groups-refresh-interval"`
+	AdminEnabled          bool          `config:"admin-enabled"`
+	SchemaRegistryURL     string        `config:"schema-registry-url"`
+	PayloadCodecs         string        `config:"payload-codecs"`
+	ProtoDescriptors      string        `config:"proto-descriptors"`
+	ProtoMappings         string        `config:"proto-mappings"`
+	ProtoTypeHeader       string        `config:"proto-type-header"`
+	HeaderBinaryEncoding  string        `config:"header-binary-encoding"`
+	RetentionMaxAge       time.Duration `config:"retention-max-age"`
+	RetentionMaxMessages  int           `config:"retention-max-messages"`
+	RetentionMaxBytes     int64         `config:"retention-max-bytes"`
+	RetentionInterval     time.Duration `config:"retention-interval"`
+	IngestBatchSize       int           `config:"ingest-batch-size"`
+	IngestBatchTimeout    time.Duration `config:"ingest-batch-timeout"`
+	IngestQueueSize       int           `config:"ingest-queue-size"`
+	SearchEnabled         bool          `config:"search-enabled"`
+	SearchMaxDocuments    int           `config:"search-max-documents"`
+	SearchMaxText         int           `config:"search-max-text"`
+	TraceHeader           string        `config:"trace-header"`
+	TracePayloadPath      string        `config:"trace-payload-path"`
+	TraceSequence         string        `config:"trace-sequence"`
+	TraceTopics           string        `config:"trace-topics"`
+	AlertRules            string        `config:"alert-rules"`
+	AlertRetries          int           `config:"alert-retries"`
+	AlertMaxLag           time.Duration `config:"alert-max-lag"`
+	ReadyMaxLag           int64         `config:"ready-max-lag"`
+	ShutdownTimeout       time.Duration `config:"shutdown-timeout"`
+	WsMaxConnections      int           `config:"ws-max-connections"`
+	WsMaxUserConnections  int           `config:"ws-max-user-connections"`
+	WsUserHeader          string        `config:"ws-user-header"`
+	WsOutboundQueueSize   int           `config:"ws-outbound-queue-size"`
+	WsOverflowPolicy      string        `config:"ws-overflow-policy"`
 }
 
 func (config *Config) Defaults() *Config {
@@ -24,19 +63,71 @@ func (config *Config) Defaults() *Config {
 	config.KafkaHost = "127.0.0.1"
 	config.KafkaPort = "9092"
 	config.KafkaGroup = "kafka-ui-messages-fetch"
+	config.KafkaVersion = "2.0.0"
 	config.DatabaseHost = "127.0.0.1"
 	config.DatabasePort = "28015"
+	config.GroupsRefreshInterval = 5 * time.Second
+	config.HeaderBinaryEncoding = "base64"
+	config.RetentionInterval = time.Minute
+	config.IngestBatchSize = 500
+	config.IngestBatchTimeout = 200 * time.Millisecond
+	config.IngestQueueSize = 10000
+	config.SearchMaxDocuments = 20000
+	config.SearchMaxText = 1024
+	config.AlertRetries = 3
+	config.AlertMaxLag = 5 * time.Minute
+	config.ShutdownTimeout = 30 * time.Second
+	config.WsMaxConnections = 1000
+	config.WsMaxUserConnections = 20
+	config.WsOutboundQueueSize = 256
+	config.WsOverflowPolicy = "dropOldest"
 	return config
 }
 
+// validate replaces the intervals which are not positive by their defaults, tickers panic on them.
+func (config *Config) validate() {
+	defaults := new(Config).Defaults()
+
+	positive := func(name string, value *time.Duration, fallback time.Duration) {
+		if *value <= 0 {
+			log.Warnf("Invalid %s %s, use the default %s", name, *value, fallback)
+			*value = fallback
+		}
+	}
+
+	positive("GROUPS_REFRESH_INTERVAL", &config.GroupsRefreshInterval, defaults.GroupsRefreshInterval)
+	positive("RETENTION_INTERVAL", &config.RetentionInterval, defaults.RetentionInterval)
+	positive("INGEST_BATCH_TIMEOUT", &config.IngestBatchTimeout, defaults.IngestBatchTimeout)
+}
+
 func (config *Config) DatabaseServer() string {
 	return fmt.Sprintf("%s:%s", config.DatabaseHost, config.DatabasePort)
 }
 
+// KafkaServers returns broker addresses from the kafka host. A host without a port gets the kafka port.
+func (config *Config) KafkaServers() []string {
+	var servers []string
+	for _, host := range strings.Split(config.KafkaHost, ",") {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+
+		if !strings.Contains(host, ":") {
+			host = fmt.Sprintf("%s:%s", host, config.KafkaPort)
+		}
+		servers = append(servers, host)
+	}
+	return servers
+}
+
 type Configure struct {
 	GlobalContext    context.Context `di.inject:"appContext"`
 	Config           *Config         `di.inject:"appConfig"`
 	serveMessageChan chan interface{}
+	// clusterID is the id of the kafka cluster from the broker metadata, it names the cluster without KAFKA_CLUSTER
+	clusterID      string
+	clusterIDMutex sync.RWMutex
 }
 
 func (configure *Configure) ServeReadChannel() <-chan interface{} {
@@ -47,13 +138,35 @@ func (configure *Configure) ServeWriteChannel() chan interface{} {
 	return configure.serveMessageChan
 }
 
+// ClusterName returns the kafka cluster name which prefixes stored message keys: KAFKA_CLUSTER or the cluster id.
+// It is empty until the consumer reads the cluster id.
+func (configure *Configure) ClusterName() string {
+	if configure.Config.KafkaCluster != "" {
+		return configure.Config.KafkaCluster
+	}
+
+	configure.clusterIDMutex.RLock()
+	defer configure.clusterIDMutex.RUnlock()
+	return configure.clusterID
+}
+
+func (configure *Configure) SetClusterID(id string) {
+	configure.clusterIDMutex.Lock()
+	configure.clusterID = id
+	configure.clusterIDMutex.Unlock()
+}
+
 func (configure *Configure) LoadConfig() (cfg *Configure, err error) {
-	configure.serveMessageChan = make(chan interface{})
+	defer func() {
+		// the ingest queue buffers consumed messages while the store inserts the previous batch
+		configure.serveMessageChan = make(chan interface{}, configure.Config.IngestQueueSize)
+	}()
 
 	if err = confita.NewLoader(env.NewBackend(), flags.NewBackend()).Load(context.Background(), configure.Config); err != nil {
 		log.Warnf("Error load config: %s", err.Error())
 		return configure, err
 	}
 
+	configure.Config.validate()
 	return configure, nil
 }
@@ -0,0 +1,178 @@
+package decoder
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	EncodingAuto    = "auto"
+	EncodingString  = "string"
+	EncodingHex     = "hex"
+	EncodingBase64  = "base64"
+	EncodingMsgpack = "msgpack"
+	EncodingCbor    = "cbor"
+	EncodingGzip    = "gzip"
+	EncodingEmpty   = "empty"
+
+	maxGzipSize = 16 << 20
+)
+
+// Codec renders a payload to a json compatible value.
+type Codec interface {
+	// Detect reports whether the payload looks like the codec encoding. Codecs which can't be recognized
+	// by content are used only when they are configured for the topic.
+	Detect(value []byte) bool
+	Decode(value []byte) (interface{}, error)
+}
+
+var codecs = map[string]Codec{
+	EncodingJson:    jsonCodec{},
+	EncodingString:  stringCodec{},
+	EncodingHex:     hexCodec{},
+	EncodingBase64:  base64Codec{},
+	EncodingMsgpack: msgpackCodec{},
+	EncodingCbor:    cborCodec{},
+}
+
+// detectOrder lists the codecs tried by auto-detection. Base64 accepts anything and goes last.
+var detectOrder = []string{EncodingJson, EncodingString, EncodingBase64}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Detect(value []byte) bool {
+	return json.Valid(value)
+}
+
+func (jsonCodec) Decode(value []byte) (interface{}, error) {
+	var body interface{}
+	if err := json.Unmarshal(value, &body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+type stringCodec struct{}
+
+func (stringCodec) Detect(value []byte) bool {
+	if !utf8.Valid(value) {
+		return false
+	}
+
+	for _, r := range string(value) {
+		if unicode.IsControl(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func (stringCodec) Decode(value []byte) (interface{}, error) {
+	if !utf8.Valid(value) {
+		return nil, fmt.Errorf("payload is not valid utf-8")
+	}
+	return string(value), nil
+}
+
+type hexCodec struct{}
+
+func (hexCodec) Detect([]byte) bool {
+	return false
+}
+
+func (hexCodec) Decode(value []byte) (interface{}, error) {
+	return hex.EncodeToString(value), nil
+}
+
+type base64Codec struct{}
+
+func (base64Codec) Detect([]byte) bool {
+	return true
+}
+
+func (base64Codec) Decode(value []byte) (interface{}, error) {
+	return base64.StdEncoding.EncodeToString(value), nil
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Detect([]byte) bool {
+	return false
+}
+
+func (msgpackCodec) Decode(value []byte) (interface{}, error) {
+	decoder := msgpack.NewDecoder(bytes.NewReader(value))
+	// maps may have non-string keys
+	decoder.SetMapDecoder(func(decoder *msgpack.Decoder) (interface{}, error) {
+		return decoder.DecodeUntypedMap()
+	})
+
+	body, err := decoder.DecodeInterface()
+	if err != nil {
+		return nil, err
+	}
+	return normalize(body), nil
+}
+
+type cborCodec struct{}
+
+func (cborCodec) Detect([]byte) bool {
+	return false
+}
+
+func (cborCodec) Decode(value []byte) (interface{}, error) {
+	var body interface{}
+	if err := cbor.Unmarshal(value, &body); err != nil {
+		return nil, err
+	}
+	return normalize(body), nil
+}
+
+func isGzip(value []byte) bool {
+	return len(value) > 2 && value[0] == 0x1f && value[1] == 0x8b
+}
+
+func gunzip(value []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(value))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return ioutil.ReadAll(io.LimitReader(reader, maxGzipSize))
+}
+
+// normalize converts maps with non-string keys, which msgpack and cbor produce, to json objects.
+func normalize(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(typed))
+		for key, item := range typed {
+			result[fmt.Sprint(key)] = normalize(item)
+		}
+		return result
+	case map[string]interface{}:
+		for key, item := range typed {
+			typed[key] = normalize(item)
+		}
+		return typed
+	case []interface{}:
+		for i, item := range typed {
+			typed[i] = normalize(item)
+		}
+		return typed
+	default:
+		return value
+	}
+}
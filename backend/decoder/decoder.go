@@ -0,0 +1,349 @@
+package decoder
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"backend/config"
+	"backend/store"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+const (
+	EncodingJson     = "json"
+	EncodingAvro     = "avro"
+	EncodingProtobuf = "protobuf"
+
+	// Confluent wire format: magic byte and big-endian schema id
+	wireMagicByte  = 0
+	wireHeaderSize = 5
+)
+
+var errNoRegistry = errors.New("schema registry is not configured")
+
+type Payload struct {
+	Encoding string
+	Value    interface{}
+	SchemaID int
+	Subject  string
+	Error    string
+}
+
+type topicCodec struct {
+	pattern  *regexp.Regexp
+	encoding string
+}
+
+// Decoder renders message payloads to json. Payloads in the Confluent wire format are decoded with the schema
+// from the registry. Raw protobuf is decoded with the message type from the type header or the topic mapping to
+// local descriptor sets. Otherwise the codec is taken from the per-topic configuration or detected by content:
+// gzip is inflated and decoded again, then json, utf-8 text and base64 for anything else are tried.
+type Decoder struct {
+	configure     *config.Configure `di.inject:"appConfigure"`
+	registry      *Registry
+	topicCodecs   []topicCodec
+	protoFiles    *protoregistry.Files
+	protoMappings []protoMapping
+	once          sync.Once
+}
+
+// DecodeOnce returns the payload which is kept in the consumed message or decodes and keeps it, so the enrichers
+// and the listeners of the ingested message decode it once.
+func (decoder *Decoder) DecodeOnce(message *store.Consumed) Payload {
+	if payload, ok := message.Decoded.(Payload); ok {
+		return payload
+	}
+
+	payload := decoder.Decode(message.Message)
+	message.Decoded = payload
+	return payload
+}
+
+// DecodeCached is DecodeOnce which never waits for the schema registry. The payload in the wire format with a
+// schema which is not cached is not decoded, the schema is looked up in the background for the next messages.
+func (decoder *Decoder) DecodeCached(message *store.Consumed) (Payload, bool) {
+	decoder.once.Do(decoder.init)
+
+	if _, ok := message.Decoded.(Payload); !ok && decoder.registry != nil && isWireFormat(message.Message.Message) {
+		switch decoder.topicEncoding(message.Topic) {
+		case EncodingAuto, EncodingAvro, EncodingProtobuf:
+			if schemaId := wireSchemaID(message.Message.Message); !decoder.registry.cached(schemaId) {
+				decoder.registry.prefetch(schemaId)
+				return Payload{}, false
+			}
+		}
+	}
+
+	return decoder.DecodeOnce(message), true
+}
+
+// Decode renders the payload of the message.
+func (decoder *Decoder) Decode(message store.Message) Payload {
+	var (
+		topic = message.Topic
+		value = message.Message
+	)
+
+	decoder.once.Do(decoder.init)
+
+	if len(value) == 0 {
+		return Payload{Encoding: EncodingEmpty}
+	}
+
+	// the codec configured for the topic wins over the detection, e.g. a string payload may start with the magic byte
+	encoding := decoder.topicEncoding(topic)
+	switch encoding {
+	case EncodingAuto:
+		if decoder.registry != nil && isWireFormat(value) {
+			return decoder.decodeWireFormat(decoder.registry, topic, value)
+		}
+
+		if messageType := decoder.protoMessageType(message); messageType != "" {
+			return decoder.decodeLocalProto(messageType, value)
+		}
+
+	case EncodingAvro, EncodingProtobuf:
+		if decoder.registry != nil && isWireFormat(value) {
+			return decoder.decodeWireFormat(decoder.registry, topic, value)
+		}
+
+		if messageType := decoder.protoMessageType(message); encoding == EncodingProtobuf && messageType != "" {
+			return decoder.decodeLocalProto(messageType, value)
+		}
+
+		if decoder.registry == nil {
+			return fallback(value, errNoRegistry)
+		}
+
+		return fallback(value, fmt.Errorf("payload is not in the schema registry wire format"))
+	}
+
+	return decodeWith(encoding, value)
+}
+
+// DecodePayload returns the decoded payload for the payload path filters.
+func (decoder *Decoder) DecodePayload(message store.Message) interface{} {
+	return decoder.Decode(message).Value
+}
+
+func (decoder *Decoder) init() {
+	if url := decoder.configure.Config.SchemaRegistryURL; url != "" {
+		decoder.registry = NewRegistry(url)
+	}
+
+	for _, mapping := range strings.Split(decoder.configure.Config.PayloadCodecs, ";") {
+		if strings.TrimSpace(mapping) == "" {
+			continue
+		}
+
+		separator := strings.LastIndex(mapping, "=")
+		if separator < 0 {
+			log.Warnf("Payload codecs: mapping '%s' must be 'topic pattern=codec'", mapping)
+			continue
+		}
+
+		pattern, err := regexp.Compile(strings.TrimSpace(mapping[:separator]))
+		if err != nil {
+			log.Warnf("Payload codecs: invalid topic pattern '%s': %s", mapping[:separator], err.Error())
+			continue
+		}
+
+		decoder.topicCodecs = append(decoder.topicCodecs, topicCodec{
+			pattern:  pattern,
+			encoding: strings.ToLower(strings.TrimSpace(mapping[separator+1:])),
+		})
+	}
+
+	if paths := decoder.configure.Config.ProtoDescriptors; paths != "" {
+		files, err := loadDescriptorSets(paths)
+		if err != nil {
+			log.Errorf("Protobuf: load descriptor sets error: %s", err.Error())
+			return
+		}
+
+		decoder.protoFiles = files
+		decoder.protoMappings = parseProtoMappings(decoder.configure.Config.ProtoMappings)
+	}
+}
+
+// protoMessageType returns the local protobuf message type named by the type header or mapped to the topic.
+func (decoder *Decoder) protoMessageType(message store.Message) protoreflect.FullName {
+	if decoder.protoFiles == nil {
+		return ""
+	}
+
+	if header := decoder.configure.Config.ProtoTypeHeader; header != "" {
+		if messageType, ok := message.HeaderValue(header); ok && len(messageType) > 0 {
+			return protoreflect.FullName(messageType)
+		}
+	}
+
+	for _, mapping := range decoder.protoMappings {
+		if mapping.pattern.MatchString(message.Topic) {
+			return mapping.messageType
+		}
+	}
+	return ""
+}
+
+func (decoder *Decoder) decodeLocalProto(messageType protoreflect.FullName, value []byte) Payload {
+	descriptor, err := findMessage(decoder.protoFiles, messageType)
+	if err != nil {
+		return fallback(value, err)
+	}
+
+	body, err := decodeProto(descriptor, value)
+	if err != nil {
+		return fallback(value, err)
+	}
+
+	return Payload{Encoding: EncodingProtobuf, Value: body}
+}
+
+func (decoder *Decoder) topicEncoding(topic string) string {
+	for _, topicCodec := range decoder.topicCodecs {
+		if topicCodec.pattern.MatchString(topic) {
+			return topicCodec.encoding
+		}
+	}
+	return EncodingAuto
+}
+
+func (decoder *Decoder) decodeWireFormat(registry *Registry, topic string, value []byte) Payload {
+	var (
+		schemaId = wireSchemaID(value)
+		data     = value[wireHeaderSize:]
+		payload  = Payload{SchemaID: schemaId}
+	)
+
+	schema, err := registry.Schema(schemaId)
+	if err != nil {
+		log.Warnf("Schema registry: read schema %d error: %s", schemaId, err.Error())
+		payload = fallback(value, err)
+		payload.SchemaID = schemaId
+		return payload
+	}
+	payload.Subject = schema.Subject(topic)
+
+	switch schema.Type {
+	case SchemaTypeAvro:
+		payload.Encoding = EncodingAvro
+		payload.Value, err = decodeAvro(schema, data)
+
+	case SchemaTypeProtobuf:
+		payload.Encoding = EncodingProtobuf
+		payload.Value, err = decodeRegistryProto(schema, data)
+
+	case SchemaTypeJson:
+		payload.Encoding = EncodingJson
+		err = json.Unmarshal(data, &payload.Value)
+	}
+
+	if err != nil {
+		log.Debugf("Decode %s payload of schema %d error: %s", schema.Type, schemaId, err.Error())
+		payload.Encoding, payload.Error = EncodingBase64, err.Error()
+		payload.Value, _ = base64Codec{}.Decode(value)
+	}
+
+	return payload
+}
+
+func decodeAvro(schema *Schema, data []byte) (interface{}, error) {
+	var value interface{}
+
+	native, _, err := schema.avro.NativeFromBinary(data)
+	if err != nil {
+		return nil, err
+	}
+
+	textual, err := schema.avro.TextualFromNative(nil, native)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(textual, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func decodeRegistryProto(schema *Schema, data []byte) (interface{}, error) {
+	indexes, data, err := readMessageIndexes(data)
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := messageByIndexes(schema.proto, indexes)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeProto(message, data)
+}
+
+// decodeWith decodes the payload with the codec. Gzip may be followed by the codec of the inflated payload,
+// e.g. 'gzip+msgpack'. A payload which the codec fails to decode is rendered as base64.
+func decodeWith(encoding string, value []byte) Payload {
+	if encoding == EncodingAuto && isGzip(value) {
+		encoding = EncodingGzip
+	}
+
+	if encoding == EncodingGzip || strings.HasPrefix(encoding, EncodingGzip+"+") {
+		inflated, err := gunzip(value)
+		if err != nil {
+			return fallback(value, err)
+		}
+
+		inner := strings.TrimPrefix(strings.TrimPrefix(encoding, EncodingGzip), "+")
+		if inner == "" {
+			inner = EncodingAuto
+		}
+
+		payload := decodeWith(inner, inflated)
+		payload.Encoding = EncodingGzip + "+" + payload.Encoding
+		return payload
+	}
+
+	if encoding == EncodingAuto {
+		for _, name := range detectOrder {
+			if codecs[name].Detect(value) {
+				encoding = name
+				break
+			}
+		}
+	}
+
+	codec, ok := codecs[encoding]
+	if !ok {
+		return fallback(value, fmt.Errorf("unknown codec: %s", encoding))
+	}
+
+	body, err := codec.Decode(value)
+	if err != nil {
+		return fallback(value, err)
+	}
+
+	return Payload{Encoding: encoding, Value: body}
+}
+
+func fallback(value []byte, err error) Payload {
+	body, _ := base64Codec{}.Decode(value)
+	return Payload{Encoding: EncodingBase64, Value: body, Error: err.Error()}
+}
+
+func isWireFormat(value []byte) bool {
+	return len(value) > wireHeaderSize && value[0] == wireMagicByte
+}
+
+// wireSchemaID returns the schema id of the payload in the wire format.
+func wireSchemaID(value []byte) int {
+	return int(binary.BigEndian.Uint32(value[1:wireHeaderSize]))
+}
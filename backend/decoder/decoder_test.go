@@ -0,0 +1,205 @@
+package decoder
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend/config"
+	"backend/store"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+func newTestDecoder(registryURL string) *Decoder {
+	return &Decoder{configure: &config.Configure{Config: &config.Config{SchemaRegistryURL: registryURL}}}
+}
+
+// wireFormat returns the payload in the Confluent wire format: the magic byte, the schema id and the data.
+func wireFormat(schemaId int, data []byte) []byte {
+	value := make([]byte, wireHeaderSize, wireHeaderSize+len(data))
+	binary.BigEndian.PutUint32(value[1:], uint32(schemaId))
+	return append(value, data...)
+}
+
+func TestDecodeCached(t *testing.T) {
+	var release = make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.URL.Path {
+		case "/schemas/ids/1":
+			<-release
+			_, _ = writer.Write([]byte(`{"schema": "{\"type\": \"string\"}"}`))
+		default:
+			http.NotFound(writer, request)
+		}
+	}))
+	defer server.Close()
+	defer func() {
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+	}()
+
+	var (
+		decoder = newTestDecoder(server.URL)
+		value   = wireFormat(1, []byte{0x04, 'h', 'i'})
+	)
+
+	message := store.Consumed{Message: store.Message{Topic: "orders", Message: value}}
+	if _, ok := decoder.DecodeCached(&message); ok {
+		t.Fatal("payload of the schema in flight is decoded")
+	}
+
+	if message.Decoded != nil {
+		t.Fatalf("payload is kept: %v", message.Decoded)
+	}
+
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for !decoder.registry.cached(1) {
+		if time.Now().After(deadline) {
+			t.Fatal("schema is not looked up in the background")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	payload, ok := decoder.DecodeCached(&message)
+	if !ok || payload.Encoding != EncodingAvro || payload.Value != "hi" {
+		t.Fatalf("decoded: got %+v, %t", payload, ok)
+	}
+
+	if kept, _ := message.Decoded.(Payload); kept.Value != "hi" {
+		t.Fatalf("payload is not kept: %v", message.Decoded)
+	}
+
+	// the payload which is not in the wire format never waits for the registry
+	text := store.Consumed{Message: store.Message{Topic: "orders", Message: []byte(`{"id": 1}`)}}
+	if payload, ok := decoder.DecodeCached(&text); !ok || payload.Encoding != EncodingJson {
+		t.Fatalf("json: got %+v, %t", payload, ok)
+	}
+}
+
+func TestDecodeWireFormat(t *testing.T) {
+	const (
+		avroSchema  = `{"type": "record", "name": "Order", "fields": [{"name": "id", "type": "long"}, {"name": "status", "type": "string"}]}`
+		orderSchema = `syntax = "proto3"; package shop; import "item.proto"; message Order { int64 id = 1; string status = 2; Item item = 3; } message Refund { int64 order = 1; }`
+		itemSchema  = `syntax = "proto3"; package shop; message Item { string sku = 1; }`
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		var body interface{}
+
+		switch request.URL.Path {
+		case "/schemas/ids/1":
+			body = map[string]interface{}{"schema": avroSchema}
+		case "/schemas/ids/1/versions":
+			body = []map[string]interface{}{{"subject": "orders-value", "version": 3}}
+		case "/schemas/ids/2":
+			body = map[string]interface{}{
+				"schemaType": SchemaTypeProtobuf,
+				"schema":     orderSchema,
+				"references": []map[string]interface{}{{"name": "item.proto", "subject": "item", "version": 1}},
+			}
+		case "/schemas/ids/2/versions":
+			body = []map[string]interface{}{{"subject": "shop-value", "version": 1}, {"subject": "orders.proto-value", "version": 2}}
+		case "/subjects/item/versions/1":
+			body = map[string]interface{}{"schemaType": SchemaTypeProtobuf, "schema": itemSchema}
+		default:
+			http.NotFound(writer, request)
+			return
+		}
+
+		_ = json.NewEncoder(writer).Encode(body)
+	}))
+	defer server.Close()
+
+	avroCodec, err := goavro.NewCodec(avroSchema)
+	if err != nil {
+		t.Fatalf("avro codec: %s", err.Error())
+	}
+
+	avroData, err := avroCodec.BinaryFromNative(nil, map[string]interface{}{"id": int64(42), "status": "paid"})
+	if err != nil {
+		t.Fatalf("avro data: %s", err.Error())
+	}
+
+	var (
+		// Order{id: 42, status: "paid", item: Item{sku: "A1"}}
+		order = []byte{0x08, 0x2a, 0x12, 0x04, 'p', 'a', 'i', 'd', 0x1a, 0x04, 0x0a, 0x02, 'A', '1'}
+		// Refund{order: 42}
+		refund = []byte{0x08, 0x2a}
+	)
+
+	tests := []struct {
+		name     string
+		topic    string
+		value    []byte
+		encoding string
+		schemaId int
+		subject  string
+		json     string
+	}{
+		{
+			name:     "avro",
+			topic:    "orders",
+			value:    wireFormat(1, avroData),
+			encoding: EncodingAvro,
+			schemaId: 1,
+			subject:  "orders-value",
+			json:     `{"id":42,"status":"paid"}`,
+		},
+		{
+			name:     "protobuf first message with reference",
+			topic:    "orders.proto",
+			value:    wireFormat(2, append([]byte{0x00}, order...)),
+			encoding: EncodingProtobuf,
+			schemaId: 2,
+			subject:  "orders.proto-value",
+			json:     `{"id":"42","item":{"sku":"A1"},"status":"paid"}`,
+		},
+		{
+			name:     "protobuf message by index",
+			topic:    "refunds",
+			value:    wireFormat(2, append([]byte{0x02, 0x02}, refund...)),
+			encoding: EncodingProtobuf,
+			schemaId: 2,
+			subject:  "shop-value",
+			json:     `{"order":"42"}`,
+		},
+		{
+			name:     "unknown schema",
+			topic:    "orders",
+			value:    wireFormat(3, []byte{0x01}),
+			encoding: EncodingBase64,
+			schemaId: 3,
+			json:     `"` + base64.StdEncoding.EncodeToString(wireFormat(3, []byte{0x01})) + `"`,
+		},
+	}
+
+	decoder := newTestDecoder(server.URL)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			payload := decoder.Decode(store.Message{Topic: test.topic, Message: test.value})
+
+			if payload.Encoding != test.encoding || payload.SchemaID != test.schemaId || payload.Subject != test.subject {
+				t.Errorf("payload: got %s, schema %d, subject %q, error %q", payload.Encoding, payload.SchemaID, payload.Subject, payload.Error)
+			}
+
+			rendered, err := json.Marshal(payload.Value)
+			if err != nil {
+				t.Fatalf("render: %s", err.Error())
+			}
+
+			if string(rendered) != test.json {
+				t.Errorf("json: got %s, want %s", rendered, test.json)
+			}
+		})
+	}
+}
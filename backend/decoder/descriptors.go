@@ -0,0 +1,119 @@
+package decoder
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const descriptorSetExt = ".desc"
+
+type protoMapping struct {
+	pattern     *regexp.Regexp
+	messageType protoreflect.FullName
+}
+
+// loadDescriptorSets reads FileDescriptorSet files. A directory contributes all its .desc files.
+func loadDescriptorSets(paths string) (*protoregistry.Files, error) {
+	var (
+		set   = new(descriptorpb.FileDescriptorSet)
+		known = map[string]bool{}
+	)
+
+	for _, path := range strings.Split(paths, ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+
+		files, err := descriptorFiles(path)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			content, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+
+			fileSet := new(descriptorpb.FileDescriptorSet)
+			if err = proto.Unmarshal(content, fileSet); err != nil {
+				return nil, fmt.Errorf("descriptor set %s: %w", file, err)
+			}
+
+			// the same dependency is usually included in several sets
+			for _, fileDescriptor := range fileSet.GetFile() {
+				if !known[fileDescriptor.GetName()] {
+					known[fileDescriptor.GetName()] = true
+					set.File = append(set.File, fileDescriptor)
+				}
+			}
+			log.Infof("Protobuf: load descriptor set %s", file)
+		}
+	}
+
+	return protodesc.NewFiles(set)
+}
+
+func descriptorFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	return filepath.Glob(filepath.Join(path, "*"+descriptorSetExt))
+}
+
+// parseProtoMappings reads 'topic pattern=message type' pairs separated by ';'.
+func parseProtoMappings(mappings string) (result []protoMapping) {
+	for _, mapping := range strings.Split(mappings, ";") {
+		if strings.TrimSpace(mapping) == "" {
+			continue
+		}
+
+		separator := strings.LastIndex(mapping, "=")
+		if separator < 0 {
+			log.Warnf("Protobuf mappings: mapping '%s' must be 'topic pattern=message type'", mapping)
+			continue
+		}
+
+		pattern, err := regexp.Compile(strings.TrimSpace(mapping[:separator]))
+		if err != nil {
+			log.Warnf("Protobuf mappings: invalid topic pattern '%s': %s", mapping[:separator], err.Error())
+			continue
+		}
+
+		result = append(result, protoMapping{
+			pattern:     pattern,
+			messageType: protoreflect.FullName(strings.TrimSpace(mapping[separator+1:])),
+		})
+	}
+	return result
+}
+
+func findMessage(files *protoregistry.Files, messageType protoreflect.FullName) (protoreflect.MessageDescriptor, error) {
+	descriptor, err := files.FindDescriptorByName(messageType)
+	if err != nil {
+		return nil, fmt.Errorf("protobuf message type %s: %w", messageType, err)
+	}
+
+	message, ok := descriptor.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a protobuf message type", messageType)
+	}
+	return message, nil
+}
@@ -0,0 +1,113 @@
+package decoder
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+var errMessageIndexes = errors.New("invalid protobuf message indexes")
+
+// toFileDescriptor converts the parsed file with its dependencies to the protobuf API descriptor.
+func toFileDescriptor(file *desc.FileDescriptor) (protoreflect.FileDescriptor, error) {
+	files := new(protoregistry.Files)
+	if err := registerFile(file, files); err != nil {
+		return nil, err
+	}
+
+	return files.FindFileByPath(file.GetName())
+}
+
+func registerFile(file *desc.FileDescriptor, files *protoregistry.Files) error {
+	if _, err := files.FindFileByPath(file.GetName()); err == nil {
+		return nil
+	}
+
+	for _, dependency := range file.GetDependencies() {
+		if err := registerFile(dependency, files); err != nil {
+			return err
+		}
+	}
+
+	fileDescriptor, err := protodesc.NewFile(file.AsFileDescriptorProto(), files)
+	if err != nil {
+		return err
+	}
+
+	return files.RegisterFile(fileDescriptor)
+}
+
+// readMessageIndexes reads the Confluent protobuf message indexes which locate the message type in the schema file.
+// A single zero stands for the first message.
+func readMessageIndexes(data []byte) ([]int, []byte, error) {
+	count, read := binary.Varint(data)
+	if read <= 0 || count < 0 {
+		return nil, nil, errMessageIndexes
+	}
+	data = data[read:]
+
+	if count == 0 {
+		return []int{0}, data, nil
+	}
+
+	indexes := make([]int, 0, count)
+	for i := int64(0); i < count; i++ {
+		index, read := binary.Varint(data)
+		if read <= 0 || index < 0 {
+			return nil, nil, errMessageIndexes
+		}
+		indexes = append(indexes, int(index))
+		data = data[read:]
+	}
+
+	return indexes, data, nil
+}
+
+func messageByIndexes(file protoreflect.FileDescriptor, indexes []int) (protoreflect.MessageDescriptor, error) {
+	var (
+		messages = file.Messages()
+		message  protoreflect.MessageDescriptor
+	)
+
+	for _, index := range indexes {
+		if index >= messages.Len() {
+			return nil, fmt.Errorf("message index %d out of range in %s", index, file.Path())
+		}
+		message = messages.Get(index)
+		messages = message.Messages()
+	}
+
+	if message == nil {
+		return nil, errMessageIndexes
+	}
+	return message, nil
+}
+
+// decodeProto decodes the message to the json form of the dynamic message.
+func decodeProto(descriptor protoreflect.MessageDescriptor, data []byte) (interface{}, error) {
+	var value interface{}
+
+	message := dynamicpb.NewMessage(descriptor)
+	if err := proto.Unmarshal(data, message); err != nil {
+		return nil, err
+	}
+
+	rendered, err := protojson.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(rendered, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
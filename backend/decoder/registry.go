@@ -0,0 +1,274 @@
+package decoder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"github.com/linkedin/goavro/v2"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	SchemaTypeAvro     = "AVRO"
+	SchemaTypeProtobuf = "PROTOBUF"
+	SchemaTypeJson     = "JSON"
+
+	registryTimeout = 10 * time.Second
+	// failureTTL is how long a failed lookup of the schema is not repeated
+	failureTTL    = 30 * time.Second
+	rootProtoFile = "schema.proto"
+)
+
+type Schema struct {
+	ID       int
+	Type     string
+	Subjects []string
+	avro     *goavro.Codec
+	proto    protoreflect.FileDescriptor
+}
+
+// Subject returns the subject registered for the topic by the topic name strategy or the first known subject.
+func (schema *Schema) Subject(topic string) string {
+	for _, subject := range schema.Subjects {
+		if strings.HasPrefix(subject, topic+"-") {
+			return subject
+		}
+	}
+
+	if len(schema.Subjects) > 0 {
+		return schema.Subjects[0]
+	}
+	return ""
+}
+
+type schemaResponse struct {
+	Schema     string            `json:"schema"`
+	SchemaType string            `json:"schemaType"`
+	References []schemaReference `json:"references"`
+}
+
+type schemaReference struct {
+	Name    string `json:"name"`
+	Subject string `json:"subject"`
+	Version int    `json:"version"`
+}
+
+type subjectVersion struct {
+	Subject string `json:"subject"`
+	Version int    `json:"version"`
+}
+
+type schemaFailure struct {
+	err   error
+	until time.Time
+}
+
+// schemaLookup is the request of the schema in flight, the concurrent lookups of the same id wait for it.
+type schemaLookup struct {
+	done   chan struct{}
+	schema *Schema
+	err    error
+}
+
+// Registry is a Confluent Schema Registry client. Parsed schemas are cached by id, the registry never changes
+// the schema of an id. Failed lookups are cached for failureTTL so an unknown id or an unavailable registry does
+// not slow down every message.
+type Registry struct {
+	url      string
+	client   *http.Client
+	schemas  map[int]*Schema
+	failures map[int]schemaFailure
+	lookups  map[int]*schemaLookup
+	mutex    sync.RWMutex
+}
+
+func NewRegistry(url string) *Registry {
+	return &Registry{
+		url:      strings.TrimRight(url, "/"),
+		client:   &http.Client{Timeout: registryTimeout},
+		schemas:  make(map[int]*Schema),
+		failures: make(map[int]schemaFailure),
+		lookups:  make(map[int]*schemaLookup),
+	}
+}
+
+func (registry *Registry) Schema(id int) (*Schema, error) {
+	registry.mutex.RLock()
+	schema, ok := registry.schemas[id]
+	registry.mutex.RUnlock()
+
+	if ok {
+		return schema, nil
+	}
+
+	registry.mutex.Lock()
+	if schema, ok = registry.schemas[id]; ok {
+		registry.mutex.Unlock()
+		return schema, nil
+	}
+
+	if failure, ok := registry.failures[id]; ok && time.Now().Before(failure.until) {
+		registry.mutex.Unlock()
+		return nil, failure.err
+	}
+
+	if lookup, ok := registry.lookups[id]; ok {
+		registry.mutex.Unlock()
+		<-lookup.done
+		return lookup.schema, lookup.err
+	}
+
+	lookup := &schemaLookup{done: make(chan struct{})}
+	registry.lookups[id] = lookup
+	registry.mutex.Unlock()
+
+	lookup.schema, lookup.err = registry.load(id)
+
+	registry.mutex.Lock()
+	if lookup.err != nil {
+		registry.failures[id] = schemaFailure{err: lookup.err, until: time.Now().Add(failureTTL)}
+	} else {
+		registry.schemas[id] = lookup.schema
+		delete(registry.failures, id)
+	}
+	delete(registry.lookups, id)
+	registry.mutex.Unlock()
+
+	close(lookup.done)
+	return lookup.schema, lookup.err
+}
+
+// cached reports whether the schema is known without a request: it is cached or its lookup failed recently.
+func (registry *Registry) cached(id int) bool {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+
+	if _, ok := registry.schemas[id]; ok {
+		return true
+	}
+
+	failure, ok := registry.failures[id]
+	return ok && time.Now().Before(failure.until)
+}
+
+// prefetch looks the schema up in the background unless the lookup is in flight.
+func (registry *Registry) prefetch(id int) {
+	registry.mutex.RLock()
+	_, ok := registry.lookups[id]
+	registry.mutex.RUnlock()
+
+	if !ok {
+		go func() {
+			_, _ = registry.Schema(id)
+		}()
+	}
+}
+
+func (registry *Registry) load(id int) (*Schema, error) {
+	var response schemaResponse
+	if err := registry.get(fmt.Sprintf("/schemas/ids/%d", id), &response); err != nil {
+		return nil, err
+	}
+
+	schema, err := registry.parse(id, response)
+	if err != nil {
+		return nil, err
+	}
+
+	// subjects are informational, old registries do not support this endpoint
+	var versions []subjectVersion
+	if err = registry.get(fmt.Sprintf("/schemas/ids/%d/versions", id), &versions); err == nil {
+		for _, version := range versions {
+			schema.Subjects = append(schema.Subjects, version.Subject)
+		}
+	}
+
+	return schema, nil
+}
+
+func (registry *Registry) parse(id int, response schemaResponse) (*Schema, error) {
+	var err error
+
+	schema := &Schema{ID: id, Type: response.SchemaType}
+	if schema.Type == "" {
+		schema.Type = SchemaTypeAvro
+	}
+
+	switch schema.Type {
+	case SchemaTypeAvro:
+		if schema.avro, err = goavro.NewCodec(response.Schema); err != nil {
+			return nil, err
+		}
+
+	case SchemaTypeProtobuf:
+		sources := map[string]string{rootProtoFile: response.Schema}
+		if err = registry.loadReferences(response.References, sources); err != nil {
+			return nil, err
+		}
+
+		if schema.proto, err = parseProto(rootProtoFile, sources); err != nil {
+			return nil, err
+		}
+
+	case SchemaTypeJson:
+
+	default:
+		return nil, fmt.Errorf("unsupported schema type: %s", schema.Type)
+	}
+
+	return schema, nil
+}
+
+func (registry *Registry) loadReferences(references []schemaReference, sources map[string]string) error {
+	for _, reference := range references {
+		if _, ok := sources[reference.Name]; ok {
+			continue
+		}
+
+		var response schemaResponse
+		if err := registry.get(fmt.Sprintf("/subjects/%s/versions/%d", reference.Subject, reference.Version), &response); err != nil {
+			return err
+		}
+
+		sources[reference.Name] = response.Schema
+		if err := registry.loadReferences(response.References, sources); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (registry *Registry) get(path string, result interface{}) error {
+	response, err := registry.client.Get(registry.url + path)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("schema registry %s: %s %s", path, response.Status, string(body))
+	}
+
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+func parseProto(fileName string, sources map[string]string) (protoreflect.FileDescriptor, error) {
+	parser := protoparse.Parser{
+		Accessor: protoparse.FileContentsFromMap(sources),
+	}
+
+	files, err := parser.ParseFiles(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	return toFileDescriptor(files[0])
+}
@@ -0,0 +1,88 @@
+package decoder
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRegistrySchema(t *testing.T) {
+	var requests int64
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		atomic.AddInt64(&requests, 1)
+
+		switch request.URL.Path {
+		case "/schemas/ids/1":
+			time.Sleep(50 * time.Millisecond)
+			_, _ = writer.Write([]byte(`{"schema": "{\"type\": \"string\"}"}`))
+		case "/schemas/ids/1/versions":
+			_, _ = writer.Write([]byte(`[{"subject": "orders-value", "version": 1}]`))
+		default:
+			http.NotFound(writer, request)
+		}
+	}))
+	defer server.Close()
+
+	registry := NewRegistry(server.URL)
+
+	t.Run("concurrent lookups share the request", func(t *testing.T) {
+		var group sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			group.Add(1)
+			go func() {
+				defer group.Done()
+
+				schema, err := registry.Schema(1)
+				if err != nil {
+					t.Errorf("schema: %s", err.Error())
+					return
+				}
+
+				if subject := schema.Subject("orders"); subject != "orders-value" {
+					t.Errorf("subject: got %s", subject)
+				}
+			}()
+		}
+		group.Wait()
+
+		if got := atomic.LoadInt64(&requests); got != 2 {
+			t.Fatalf("requests: got %d, want 2", got)
+		}
+	})
+
+	t.Run("failures are cached", func(t *testing.T) {
+		atomic.StoreInt64(&requests, 0)
+
+		for i := 0; i < 3; i++ {
+			if _, err := registry.Schema(2); err == nil {
+				t.Fatal("unknown schema: expected error")
+			}
+		}
+
+		if got := atomic.LoadInt64(&requests); got != 1 {
+			t.Fatalf("requests: got %d, want 1", got)
+		}
+	})
+
+	t.Run("failures expire", func(t *testing.T) {
+		atomic.StoreInt64(&requests, 0)
+
+		registry.mutex.Lock()
+		failure := registry.failures[2]
+		failure.until = time.Now()
+		registry.failures[2] = failure
+		registry.mutex.Unlock()
+
+		if _, err := registry.Schema(2); err == nil {
+			t.Fatal("unknown schema: expected error")
+		}
+
+		if got := atomic.LoadInt64(&requests); got != 1 {
+			t.Fatalf("requests: got %d, want 1", got)
+		}
+	})
+}
@@ -0,0 +1,101 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"backend/store"
+)
+
+const maxLineSize = 64 << 20
+
+// ReadBundle calls the function for every message of the replay bundle. Plain jsonl exports are read too.
+func ReadBundle(reader io.Reader, fn func(store.Message) error) error {
+	buffered := bufio.NewReader(reader)
+
+	if magic, err := buffered.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gzipReader, err := gzip.NewReader(buffered)
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	} else {
+		reader = buffered
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxLineSize)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var header BundleHeader
+		if line == 1 && json.Unmarshal(scanner.Bytes(), &header) == nil && header.Format == BundleFormat {
+			if header.Version > BundleVersion {
+				return fmt.Errorf("bundle version %d is not supported", header.Version)
+			}
+			continue
+		}
+
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		message, err := record.message()
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if err = fn(message); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+func (record Record) message() (message store.Message, err error) {
+	message = store.Message{
+		Topic:     record.Topic,
+		Partition: record.Partition,
+		Offset:    record.Offset,
+		At:        time.Unix(0, record.Timestamp*int64(time.Millisecond)),
+		Timestamp: record.Timestamp / 1000,
+	}
+
+	if message.Key, err = decodeText(record.Key, record.KeyEncoding); err != nil {
+		return message, fmt.Errorf("key: %w", err)
+	}
+
+	if message.Message, err = base64.StdEncoding.DecodeString(record.Value); err != nil {
+		return message, fmt.Errorf("value: %w", err)
+	}
+	message.Size = len(message.Message)
+
+	for _, header := range record.Headers {
+		value, err := decodeText(header.Value, header.Encoding)
+		if err != nil {
+			return message, fmt.Errorf("header %s: %w", header.Key, err)
+		}
+		message.Headers = append(message.Headers, store.Header{Key: header.Key, Value: value})
+	}
+
+	return message, nil
+}
+
+func decodeText(value string, encoding string) ([]byte, error) {
+	if encoding == store.HeaderEncodingBase64 {
+		return base64.StdEncoding.DecodeString(value)
+	}
+	return []byte(value), nil
+}
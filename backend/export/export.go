@@ -0,0 +1,255 @@
+package export
+
+import (
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/decoder"
+	"backend/store"
+)
+
+const (
+	FormatJsonl  = "jsonl"
+	FormatCsv    = "csv"
+	FormatBundle = "bundle"
+
+	// BundleFormat and BundleVersion mark the first line of the replay bundle
+	BundleFormat  = "kafka-ui-replay"
+	BundleVersion = 1
+)
+
+var (
+	columns        = []string{"topic", "partition", "offset", "timestamp", "at", "key", "headers", "size", "value", "payload"}
+	DefaultColumns = []string{"topic", "partition", "offset", "timestamp", "key", "value"}
+)
+
+// Writer writes the exported messages in a format.
+type Writer interface {
+	Write(message store.Message) error
+	Close() error
+}
+
+type Header struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type Record struct {
+	Topic       string   `json:"topic"`
+	Partition   int      `json:"partition"`
+	Offset      int      `json:"offset"`
+	Timestamp   int64    `json:"timestamp"`
+	Key         string   `json:"key"`
+	KeyEncoding string   `json:"keyEncoding,omitempty"`
+	Headers     []Header `json:"headers"`
+	Value       string   `json:"value"`
+}
+
+// BundleHeader is the first line of the replay bundle.
+type BundleHeader struct {
+	Format   string    `json:"format"`
+	Version  int       `json:"version"`
+	Exported time.Time `json:"exported"`
+}
+
+// New returns the writer of the format. The csv columns are checked against the known columns. Nothing is written
+// to the writer before the first message or Close, so the caller may set the response headers after New.
+func New(format string, columnNames []string, payloadDecoder *decoder.Decoder, writer io.Writer) (Writer, error) {
+	switch format {
+	case FormatJsonl, "":
+		return &jsonlWriter{encoder: json.NewEncoder(writer)}, nil
+
+	case FormatCsv:
+		if len(columnNames) == 0 {
+			columnNames = DefaultColumns
+		}
+
+		for _, name := range columnNames {
+			if !isColumn(name) {
+				return nil, fmt.Errorf("unknown column: %s, columns: %s", name, strings.Join(columns, ", "))
+			}
+		}
+
+		csvWriter := &csvWriter{writer: csv.NewWriter(writer), columns: columnNames, decoder: payloadDecoder}
+		return csvWriter, csvWriter.writer.Write(columnNames)
+
+	case FormatBundle:
+		gzipWriter := gzip.NewWriter(writer)
+		return &bundleWriter{gzip: gzipWriter, encoder: json.NewEncoder(gzipWriter)}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown export format: %s", format)
+	}
+}
+
+// ContentType returns the content type and the file extension of the format.
+func ContentType(format string) (string, string) {
+	switch format {
+	case FormatCsv:
+		return "text/csv", ".csv"
+	case FormatBundle:
+		return "application/gzip", ".replay.jsonl.gz"
+	default:
+		return "application/x-ndjson", ".jsonl"
+	}
+}
+
+// jsonlWriter writes a json record per line. Headers and the key are utf-8 when possible, the value is base64.
+type jsonlWriter struct {
+	encoder *json.Encoder
+}
+
+func (writer *jsonlWriter) Write(message store.Message) error {
+	record := Record{
+		Topic:     message.Topic,
+		Partition: message.Partition,
+		Offset:    message.Offset,
+		Timestamp: message.At.UnixNano() / int64(time.Millisecond),
+		Headers:   make([]Header, 0, len(message.Headers)),
+		Value:     base64.StdEncoding.EncodeToString(message.Message),
+	}
+	record.Key, record.KeyEncoding = store.Render(message.Key)
+
+	for _, header := range message.Headers {
+		value, encoding := header.Render()
+		record.Headers = append(record.Headers, Header{Key: header.Key, Value: value, Encoding: encoding})
+	}
+
+	return writer.encoder.Encode(record)
+}
+
+func (writer *jsonlWriter) Close() error {
+	return nil
+}
+
+// bundleWriter writes gzipped json records in which the key and the headers are base64 too, so the import
+// publishes the exact bytes.
+type bundleWriter struct {
+	gzip    *gzip.Writer
+	encoder *json.Encoder
+	started bool
+}
+
+// start writes the bundle header before the first record, an empty bundle has the header only.
+func (writer *bundleWriter) start() error {
+	if writer.started {
+		return nil
+	}
+
+	writer.started = true
+	return writer.encoder.Encode(BundleHeader{Format: BundleFormat, Version: BundleVersion, Exported: time.Now().UTC()})
+}
+
+func (writer *bundleWriter) Write(message store.Message) error {
+	if err := writer.start(); err != nil {
+		return err
+	}
+
+	record := Record{
+		Topic:       message.Topic,
+		Partition:   message.Partition,
+		Offset:      message.Offset,
+		Timestamp:   message.At.UnixNano() / int64(time.Millisecond),
+		Key:         base64.StdEncoding.EncodeToString(message.Key),
+		KeyEncoding: store.HeaderEncodingBase64,
+		Headers:     make([]Header, 0, len(message.Headers)),
+		Value:       base64.StdEncoding.EncodeToString(message.Message),
+	}
+
+	for _, header := range message.Headers {
+		record.Headers = append(record.Headers, Header{
+			Key:      header.Key,
+			Value:    base64.StdEncoding.EncodeToString(header.Value),
+			Encoding: store.HeaderEncodingBase64,
+		})
+	}
+
+	return writer.encoder.Encode(record)
+}
+
+func (writer *bundleWriter) Close() error {
+	if err := writer.start(); err != nil {
+		return err
+	}
+	return writer.gzip.Close()
+}
+
+type csvWriter struct {
+	writer  *csv.Writer
+	columns []string
+	decoder *decoder.Decoder
+}
+
+func (writer *csvWriter) Write(message store.Message) error {
+	row := make([]string, 0, len(writer.columns))
+
+	for _, column := range writer.columns {
+		var value string
+
+		switch column {
+		case "topic":
+			value = message.Topic
+		case "partition":
+			value = strconv.Itoa(message.Partition)
+		case "offset":
+			value = strconv.Itoa(message.Offset)
+		case "timestamp":
+			value = strconv.FormatInt(message.At.UnixNano()/int64(time.Millisecond), 10)
+		case "at":
+			value = message.At.Format(time.RFC3339Nano)
+		case "key":
+			value, _ = store.Render(message.Key)
+		case "headers":
+			headers := make([]string, 0, len(message.Headers))
+			for _, header := range message.Headers {
+				rendered, _ := header.Render()
+				headers = append(headers, header.Key+"="+rendered)
+			}
+			value = strings.Join(headers, ";")
+		case "size":
+			value = strconv.Itoa(message.Size)
+		case "value":
+			value = base64.StdEncoding.EncodeToString(message.Message)
+		case "payload":
+			value = payloadText(writer.decoder.Decode(message))
+		}
+
+		row = append(row, value)
+	}
+
+	return writer.writer.Write(row)
+}
+
+func (writer *csvWriter) Close() error {
+	writer.writer.Flush()
+	return writer.writer.Error()
+}
+
+func payloadText(payload decoder.Payload) string {
+	if text, ok := payload.Value.(string); ok {
+		return text
+	}
+
+	body, err := json.Marshal(payload.Value)
+	if err != nil {
+		return ""
+	}
+	return string(body)
+}
+
+func isColumn(name string) bool {
+	for _, column := range columns {
+		if column == name {
+			return true
+		}
+	}
+	return false
+}
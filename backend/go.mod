@@ -3,19 +3,26 @@ module backend
 go 1.15
 
 require (
+	github.com/Shopify/sarama v1.27.2
 	github.com/confluentinc/confluent-kafka-go v1.5.2 // indirect
+	github.com/fxamacker/cbor/v2 v2.3.0
 	github.com/gobwas/httphead v0.1.0 // indirect
 	github.com/gobwas/pool v0.2.1 // indirect
 	github.com/gobwas/ws v1.0.4
 	github.com/goioc/di v1.5.0
 	github.com/google/uuid v1.2.0
 	github.com/heetch/confita v0.9.2
+	github.com/jhump/protoreflect v1.8.2
 	github.com/kr/pretty v0.2.1 // indirect
+	github.com/linkedin/goavro/v2 v2.10.0
 	github.com/pkg/errors v0.9.1 // indirect
+	github.com/prometheus/client_golang v1.8.0
 	github.com/sirupsen/logrus v1.7.0
+	github.com/vmihailenco/msgpack/v5 v5.3.4
 	golang.org/x/crypto v0.0.0-20201112155050-0c6587e931a9 // indirect
 	golang.org/x/net v0.0.0-20201021035429-f5854403a974 // indirect
 	golang.org/x/sys v0.0.0-20201113233024-12cec1faf1ba // indirect
+	google.golang.org/protobuf v1.26.0
 	gopkg.in/confluentinc/confluent-kafka-go.v1 v1.5.2
 	gopkg.in/rethinkdb/rethinkdb-go.v6 v6.2.1
 	gopkg.in/yaml.v3 v3.0.0-20200615113413-eeeca48fe776 // indirect
@@ -0,0 +1,95 @@
+package health
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// Kafka is the connectivity of the kafka cluster, checked by the admin client
+	Kafka = "kafka"
+	// Consumer is the subscription of the message consumer
+	Consumer = "consumer"
+	// Store is the connectivity of the db
+	Store = "store"
+	// Ingest is the lag of the consumer group of the messages
+	Ingest = "ingest"
+)
+
+// Required are the components which must be up for the readiness.
+var Required = []string{Kafka, Consumer, Store, Ingest}
+
+type Component struct {
+	Name  string
+	Up    bool
+	Error string
+	// Since is the time of the last status change
+	Since time.Time
+}
+
+// Health keeps the status of the components which the services report. A component is down until the first report.
+type Health struct {
+	mutex      sync.RWMutex
+	components map[string]Component
+	lag        int64
+}
+
+func (health *Health) Up(name string) {
+	health.set(name, true, "")
+}
+
+func (health *Health) Down(name string, err error) {
+	health.set(name, false, err.Error())
+}
+
+func (health *Health) set(name string, up bool, message string) {
+	health.mutex.Lock()
+	defer health.mutex.Unlock()
+
+	if health.components == nil {
+		health.components = make(map[string]Component)
+	}
+
+	current, ok := health.components[name]
+	if !ok || current.Up != up {
+		current.Since = time.Now()
+	}
+	current.Name, current.Up, current.Error = name, up, message
+	health.components[name] = current
+}
+
+// SetLag sets the total lag of the consumer group of the messages.
+func (health *Health) SetLag(lag int64) {
+	health.mutex.Lock()
+	health.lag = lag
+	health.mutex.Unlock()
+}
+
+func (health *Health) Lag() int64 {
+	health.mutex.RLock()
+	defer health.mutex.RUnlock()
+	return health.lag
+}
+
+// Components returns the status of the required components in their order and reports whether all of them are up.
+func (health *Health) Components() ([]Component, bool) {
+	health.mutex.RLock()
+	defer health.mutex.RUnlock()
+
+	var (
+		result = make([]Component, 0, len(Required))
+		ready  = true
+	)
+
+	for _, name := range Required {
+		current, ok := health.components[name]
+		if !ok {
+			current = Component{Name: name, Error: "not checked yet"}
+		}
+
+		ready = ready && current.Up
+		result = append(result, current)
+	}
+
+	return result, ready
+}
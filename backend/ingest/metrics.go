@@ -0,0 +1,83 @@
+package ingest
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Metrics counts messages on the way from the kafka consumer to the store.
+type Metrics struct {
+	consumed   int64
+	stored     int64
+	failed     int64
+	batches    int64
+	paused     int32
+	rate       int64
+	lastStored int64
+	queue      chan interface{}
+}
+
+type Snapshot struct {
+	Consumed      int64
+	Stored        int64
+	Failed        int64
+	Batches       int64
+	QueueDepth    int
+	QueueCapacity int
+	Paused        bool
+	StoredPerSec  int64
+}
+
+// SetQueue sets the queue of the consumed messages which depth the snapshot reports.
+func (metrics *Metrics) SetQueue(queue chan interface{}) {
+	metrics.queue = queue
+}
+
+func (metrics *Metrics) AddConsumed(count int) {
+	atomic.AddInt64(&metrics.consumed, int64(count))
+}
+
+func (metrics *Metrics) AddBatch(stored int, failed int) {
+	atomic.AddInt64(&metrics.batches, 1)
+	atomic.AddInt64(&metrics.stored, int64(stored))
+	atomic.AddInt64(&metrics.failed, int64(failed))
+}
+
+// AddFailed counts the messages of a batch which the store failed to insert, the batch is counted by AddBatch when
+// the insert succeeds.
+func (metrics *Metrics) AddFailed(count int) {
+	atomic.AddInt64(&metrics.failed, int64(count))
+}
+
+func (metrics *Metrics) SetPaused(paused bool) {
+	var value int32
+	if paused {
+		value = 1
+	}
+	atomic.StoreInt32(&metrics.paused, value)
+}
+
+// UpdateRate computes the stored messages per second since the previous update made the interval ago.
+func (metrics *Metrics) UpdateRate(interval time.Duration) {
+	stored := atomic.LoadInt64(&metrics.stored)
+	last := atomic.SwapInt64(&metrics.lastStored, stored)
+	atomic.StoreInt64(&metrics.rate, int64(float64(stored-last)/interval.Seconds()))
+}
+
+// InFlight returns the number of the consumed messages which are not stored yet.
+func (metrics *Metrics) InFlight() int64 {
+	return atomic.LoadInt64(&metrics.consumed) - atomic.LoadInt64(&metrics.stored)
+}
+
+func (metrics *Metrics) Snapshot() Snapshot {
+	return Snapshot{
+		Consumed:      atomic.LoadInt64(&metrics.consumed),
+		Stored:        atomic.LoadInt64(&metrics.stored),
+		Failed:        atomic.LoadInt64(&metrics.failed),
+		Batches:       atomic.LoadInt64(&metrics.batches),
+		QueueDepth:    len(metrics.queue),
+		QueueCapacity: cap(metrics.queue),
+		Paused:        atomic.LoadInt32(&metrics.paused) == 1,
+		StoredPerSec:  atomic.LoadInt64(&metrics.rate),
+	}
+}
@@ -0,0 +1,38 @@
+package ingest
+
+import "sync"
+
+type TopicPartition struct {
+	Topic     string
+	Partition int32
+}
+
+// StoredOffsets collects the last offsets which the store acknowledged until the consumer commits them.
+type StoredOffsets struct {
+	mutex   sync.Mutex
+	offsets map[TopicPartition]int64
+}
+
+func (stored *StoredOffsets) Mark(topic string, partition int32, offset int64) {
+	stored.mutex.Lock()
+	defer stored.mutex.Unlock()
+
+	if stored.offsets == nil {
+		stored.offsets = make(map[TopicPartition]int64)
+	}
+
+	key := TopicPartition{Topic: topic, Partition: partition}
+	if current, ok := stored.offsets[key]; !ok || offset > current {
+		stored.offsets[key] = offset
+	}
+}
+
+// Take returns the marked offsets and forgets them.
+func (stored *StoredOffsets) Take() map[TopicPartition]int64 {
+	stored.mutex.Lock()
+	defer stored.mutex.Unlock()
+
+	offsets := stored.offsets
+	stored.offsets = nil
+	return offsets
+}
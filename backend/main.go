@@ -5,10 +5,17 @@ import (
 	"os"
 	"reflect"
 
+	"backend/alert"
 	"backend/application"
 	"backend/config"
+	"backend/decoder"
+	"backend/health"
+	"backend/ingest"
 	"backend/provider"
+	"backend/search"
+	"backend/stats"
 	"backend/store"
+	"backend/trace"
 	"backend/ws"
 
 	"github.com/goioc/di"
@@ -36,14 +43,24 @@ func initContainers() *application.Application {
 	_, _ = di.RegisterBeanInstance("appContext", ctx)
 	_, _ = di.RegisterBeanInstance("appConfig", new(config.Config).Defaults())
 	_, _ = di.RegisterBean("appConfigure", reflect.TypeOf((*config.Configure)(nil)))
+	_, _ = di.RegisterBeanInstance("health", new(health.Health))
+	_, _ = di.RegisterBeanInstance("ingestMetrics", new(ingest.Metrics))
+	_, _ = di.RegisterBeanInstance("storedOffsets", new(ingest.StoredOffsets))
+	_, _ = di.RegisterBean("decoderService", reflect.TypeOf((*decoder.Decoder)(nil)))
 	_, _ = di.RegisterBean("wsService", reflect.TypeOf((*ws.WsService)(nil)))
 	_, _ = di.RegisterBean("providerService", reflect.TypeOf((*provider.Provider)(nil)))
+	_, _ = di.RegisterBean("adminService", reflect.TypeOf((*provider.Admin)(nil)))
 	_, _ = di.RegisterBean("storeService", reflect.TypeOf((*store.RethinkService)(nil)))
+	_, _ = di.RegisterBean("searchService", reflect.TypeOf((*search.Search)(nil)))
+	_, _ = di.RegisterBean("traceService", reflect.TypeOf((*trace.Tracer)(nil)))
+	_, _ = di.RegisterBean("alertService", reflect.TypeOf((*alert.Alerter)(nil)))
+	_, _ = di.RegisterBean("statsService", reflect.TypeOf((*stats.Stats)(nil)))
 	_ = di.InitializeContainer()
 
-	if _, err := di.GetInstance("appConfigure").(*config.Configure).LoadConfig(); err != nil {
+	configure, err := di.GetInstance("appConfigure").(*config.Configure).LoadConfig()
+	if err != nil {
 		log.Error(err.Error())
 	}
 
-	return application.New(cancel, "storeService", "providerService", "wsService")
+	return application.New(cancel, configure.Config.ShutdownTimeout, "storeService", "searchService", "traceService", "alertService", "statsService", "providerService", "adminService", "wsService")
 }
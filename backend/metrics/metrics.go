@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"backend/ingest"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "kafka_ui"
+
+var (
+	ConsumedMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "consumed_messages_total",
+		Help:      "Messages consumed from kafka by topic.",
+	}, []string{"topic"})
+
+	KafkaErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "kafka_errors_total",
+		Help:      "Kafka consumer errors by operation.",
+	}, []string{"operation"})
+
+	StoredMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "stored_messages_total",
+		Help:      "Messages inserted to the store by topic.",
+	}, []string{"topic"})
+
+	InsertDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "insert_duration_seconds",
+		Help:      "Duration of the batch inserts to the store.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+	})
+
+	InsertErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "insert_errors_total",
+		Help:      "Failed batch inserts to the store.",
+	})
+
+	ChangeFeeds = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "change_feeds",
+		Help:      "Open change feeds of the store.",
+	})
+
+	ChangeFeedErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "change_feed_errors_total",
+		Help:      "Change feed errors of the store.",
+	})
+
+	Sockets = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "websocket_connections",
+		Help:      "Open websocket connections.",
+	})
+
+	SocketMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_messages_total",
+		Help:      "Websocket messages by direction.",
+	}, []string{"direction"})
+
+	SocketDroppedMessages = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_dropped_messages_total",
+		Help:      "Live messages dropped from the outbound queues of the slow sockets.",
+	})
+
+	ConsumerLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "consumer_lag",
+		Help:      "Lag of the kafka-ui consumer group by topic partition.",
+	}, []string{"topic", "partition"})
+)
+
+// RegisterIngest exposes the ingest queue depth and the backpressure state.
+func RegisterIngest(ingestMetrics *ingest.Metrics) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "ingest_queue_depth",
+		Help:      "Consumed messages waiting for the insert.",
+	}, func() float64 { return float64(ingestMetrics.Snapshot().QueueDepth) })
+
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "ingest_paused",
+		Help:      "1 while the consumer is paused by the backpressure.",
+	}, func() float64 {
+		if ingestMetrics.Snapshot().Paused {
+			return 1
+		}
+		return 0
+	})
+}
@@ -0,0 +1,334 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"backend/config"
+	"backend/health"
+	"backend/metrics"
+
+	"github.com/Shopify/sarama"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+type GroupMember struct {
+	MemberID    string
+	ClientID    string
+	ClientHost  string
+	Assignments map[string][]int32
+}
+
+type GroupOffset struct {
+	Topic     string
+	Partition int32
+	Committed int64
+	High      int64
+	Lag       int64
+}
+
+type ConsumerGroup struct {
+	GroupID  string
+	State    string
+	Protocol string
+	Members  []GroupMember
+	Offsets  []GroupOffset
+	TotalLag int64
+}
+
+// Admin inspects the cluster state which is not available for the consumer: consumer groups, their members and offsets.
+// Topic administration goes through the kafka AdminClient. The AdminClient of confluent-kafka-go v1.5 can neither list
+// nor describe consumer groups nor read or commit their offsets, so the groups go through the sarama cluster admin.
+// Connections are created on first use.
+type Admin struct {
+	configure    *config.Configure `di.inject:"appConfigure"`
+	healthSvc    *health.Health    `di.inject:"health"`
+	client       sarama.Client
+	clusterAdmin sarama.ClusterAdmin
+	adminClient  *kafka.AdminClient
+	mutex        sync.Mutex
+	stop         chan struct{}
+}
+
+func (admin *Admin) Serve() {
+	admin.stop = make(chan struct{})
+	go admin.serveLagMetrics()
+}
+
+// serveLagMetrics refreshes the lag of the kafka-ui consumer group, it is the kafka and the ingest health check as well.
+func (admin *Admin) serveLagMetrics() {
+	var (
+		maxLag = admin.configure.Config.ReadyMaxLag
+		ticker = time.NewTicker(admin.configure.Config.GroupsRefreshInterval)
+	)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-admin.configure.GlobalContext.Done():
+			return
+
+		case <-admin.stop:
+			return
+
+		case <-ticker.C:
+			groups, err := admin.ConsumerGroups(admin.configure.Config.KafkaGroup)
+			if err != nil {
+				log.Debugf("Kafka admin: consumer lag error: %s", err.Error())
+				admin.healthSvc.Down(health.Kafka, err)
+				continue
+			}
+			admin.healthSvc.Up(health.Kafka)
+
+			var lag int64
+			metrics.ConsumerLag.Reset()
+			for _, group := range groups {
+				lag += group.TotalLag
+				for _, offset := range group.Offsets {
+					metrics.ConsumerLag.WithLabelValues(offset.Topic, strconv.Itoa(int(offset.Partition))).Set(float64(offset.Lag))
+				}
+			}
+
+			admin.healthSvc.SetLag(lag)
+			if maxLag > 0 && lag > maxLag {
+				admin.healthSvc.Down(health.Ingest, fmt.Errorf("consumer lag %d exceeds %d", lag, maxLag))
+			} else {
+				admin.healthSvc.Up(health.Ingest)
+			}
+		}
+	}
+}
+
+func (admin *Admin) Stop(ctx context.Context) {
+	close(admin.stop)
+
+	admin.mutex.Lock()
+	defer admin.mutex.Unlock()
+
+	if admin.clusterAdmin != nil {
+		log.Info("Kafka admin: close connection....")
+		if err := admin.clusterAdmin.Close(); err != nil {
+			log.Warnf("Kafka admin: failed to close connection: %s", err.Error())
+		}
+		admin.clusterAdmin, admin.client = nil, nil
+	}
+
+	if admin.adminClient != nil {
+		admin.adminClient.Close()
+		admin.adminClient = nil
+	}
+}
+
+// ConsumerGroups returns consumer groups with members, committed offsets and lag. An empty group returns all groups.
+func (admin *Admin) ConsumerGroups(group string) ([]ConsumerGroup, error) {
+	var (
+		groupIds     []string
+		descriptions []*sarama.GroupDescription
+		err          error
+	)
+
+	if err = admin.connect(); err != nil {
+		return nil, err
+	}
+
+	if group != "" {
+		groupIds = []string{group}
+	} else {
+		var groups map[string]string
+		if groups, err = admin.clusterAdmin.ListConsumerGroups(); err != nil {
+			return nil, err
+		}
+
+		for groupId := range groups {
+			groupIds = append(groupIds, groupId)
+		}
+	}
+
+	if descriptions, err = admin.clusterAdmin.DescribeConsumerGroups(groupIds); err != nil {
+		return nil, err
+	}
+
+	var result []ConsumerGroup
+	for _, description := range descriptions {
+		if description.Err != sarama.ErrNoError {
+			log.Warnf("Kafka admin: describe group '%s' error: %s", description.GroupId, description.Err.Error())
+			continue
+		}
+
+		consumerGroup := ConsumerGroup{
+			GroupID:  description.GroupId,
+			State:    description.State,
+			Protocol: description.Protocol,
+		}
+
+		for memberId, member := range description.Members {
+			groupMember := GroupMember{
+				MemberID:   memberId,
+				ClientID:   member.ClientId,
+				ClientHost: member.ClientHost,
+			}
+
+			if description.ProtocolType == "consumer" {
+				if assignment, err := member.GetMemberAssignment(); err == nil {
+					groupMember.Assignments = assignment.Topics
+				} else {
+					log.Debugf("Kafka admin: member '%s' assignment decode error: %s", memberId, err.Error())
+				}
+			}
+			consumerGroup.Members = append(consumerGroup.Members, groupMember)
+		}
+
+		if consumerGroup.Offsets, err = admin.groupOffsets(description.GroupId); err != nil {
+			return nil, err
+		}
+
+		for _, offset := range consumerGroup.Offsets {
+			consumerGroup.TotalLag += offset.Lag
+		}
+
+		sort.Slice(consumerGroup.Members, func(i, j int) bool {
+			return consumerGroup.Members[i].MemberID < consumerGroup.Members[j].MemberID
+		})
+		result = append(result, consumerGroup)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].GroupID < result[j].GroupID
+	})
+
+	return result, nil
+}
+
+// WatchConsumerGroups pushes consumer groups each refresh interval. A value from groupChan selects the watched group,
+// an empty value selects all groups.
+func (admin *Admin) WatchConsumerGroups(socketContext context.Context, groupChan <-chan string) <-chan []ConsumerGroup {
+	groupsChan := make(chan []ConsumerGroup, 1)
+
+	go func() {
+		var (
+			group    string
+			watching bool
+			ticker   = time.NewTicker(admin.configure.Config.GroupsRefreshInterval)
+		)
+		defer ticker.Stop()
+		defer close(groupsChan)
+
+		push := func() {
+			groups, err := admin.ConsumerGroups(group)
+			if err != nil {
+				log.Warnf("Kafka admin: read consumer groups error: %s", err.Error())
+				return
+			}
+
+			select {
+			case groupsChan <- groups:
+			case <-socketContext.Done():
+			case <-admin.configure.GlobalContext.Done():
+			}
+		}
+
+		for {
+			select {
+			case <-socketContext.Done():
+				log.Info("Stop watching consumer groups. Socket context close")
+				return
+
+			case <-admin.configure.GlobalContext.Done():
+				log.Info("Stop watching consumer groups. Application context close")
+				return
+
+			case group = <-groupChan:
+				watching = true
+				push()
+
+			case <-ticker.C:
+				if watching {
+					push()
+				}
+			}
+		}
+	}()
+
+	return groupsChan
+}
+
+func (admin *Admin) groupOffsets(group string) ([]GroupOffset, error) {
+	response, err := admin.clusterAdmin.ListConsumerGroupOffsets(group, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var offsets []GroupOffset
+	for topic, partitions := range response.Blocks {
+		for partition, block := range partitions {
+			if block.Err != sarama.ErrNoError {
+				log.Warnf("Kafka admin: offset of group '%s' for %s/%d error: %s", group, topic, partition, block.Err.Error())
+				continue
+			}
+
+			high, err := admin.client.GetOffset(topic, partition, sarama.OffsetNewest)
+			if err != nil {
+				return nil, err
+			}
+
+			offset := GroupOffset{
+				Topic:     topic,
+				Partition: partition,
+				Committed: block.Offset,
+				High:      high,
+			}
+
+			if block.Offset >= 0 && high > block.Offset {
+				offset.Lag = high - block.Offset
+			}
+			offsets = append(offsets, offset)
+		}
+	}
+
+	sort.Slice(offsets, func(i, j int) bool {
+		if offsets[i].Topic != offsets[j].Topic {
+			return offsets[i].Topic < offsets[j].Topic
+		}
+		return offsets[i].Partition < offsets[j].Partition
+	})
+
+	return offsets, nil
+}
+
+func (admin *Admin) connect() error {
+	var (
+		client       sarama.Client
+		clusterAdmin sarama.ClusterAdmin
+		err          error
+	)
+
+	admin.mutex.Lock()
+	defer admin.mutex.Unlock()
+
+	if admin.clusterAdmin != nil {
+		return nil
+	}
+
+	saramaConfig := sarama.NewConfig()
+	saramaConfig.ClientID = admin.configure.Config.KafkaGroup
+	if saramaConfig.Version, err = sarama.ParseKafkaVersion(admin.configure.Config.KafkaVersion); err != nil {
+		return err
+	}
+
+	if client, err = sarama.NewClient(admin.configure.Config.KafkaServers(), saramaConfig); err != nil {
+		return err
+	}
+
+	if clusterAdmin, err = sarama.NewClusterAdminFromClient(client); err != nil {
+		_ = client.Close()
+		return err
+	}
+
+	admin.client, admin.clusterAdmin = client, clusterAdmin
+	return nil
+}
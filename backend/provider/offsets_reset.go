@@ -0,0 +1,216 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Shopify/sarama"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+type ResetMode int
+
+const (
+	// ResetUnset is the zero mode, the request must choose the mode explicitly
+	ResetUnset ResetMode = iota
+	ResetToEarliest
+	ResetToLatest
+	ResetToTimestamp
+	ResetToOffset
+	ResetShiftBy
+)
+
+var (
+	ErrGroupActive       = errors.New("consumer group has active members")
+	ErrResetModeRequired = errors.New("reset mode is required")
+)
+
+type OffsetResetRequest struct {
+	Group string
+	Topic string
+	// Partitions to reset, all partitions of the topic when empty
+	Partitions []int32
+	Mode       ResetMode
+	// Timestamp in milliseconds for ResetToTimestamp
+	Timestamp int64
+	// Offset for ResetToOffset or the shift for ResetShiftBy
+	Offset int64
+	DryRun bool
+}
+
+type OffsetReset struct {
+	Topic     string
+	Partition int32
+	Current   int64
+	Target    int64
+}
+
+// ResetOffsets moves committed offsets of the group. Targets are bounded by the partition watermarks.
+// The dry run only returns the resulting offsets. The group must not have active members.
+func (admin *Admin) ResetOffsets(request OffsetResetRequest) ([]OffsetReset, error) {
+	var (
+		descriptions []*sarama.GroupDescription
+		partitions   = request.Partitions
+		err          error
+	)
+
+	if request.Mode == ResetUnset {
+		return nil, ErrResetModeRequired
+	}
+
+	if !request.DryRun {
+		if err = admin.checkEnabled(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = admin.connect(); err != nil {
+		return nil, err
+	}
+
+	if descriptions, err = admin.clusterAdmin.DescribeConsumerGroups([]string{request.Group}); err != nil {
+		return nil, err
+	}
+
+	for _, description := range descriptions {
+		if description.Err != sarama.ErrNoError {
+			return nil, description.Err
+		}
+
+		if len(description.Members) > 0 {
+			return nil, ErrGroupActive
+		}
+	}
+
+	if len(partitions) == 0 {
+		if partitions, err = admin.client.Partitions(request.Topic); err != nil {
+			return nil, err
+		}
+	}
+
+	committed, err := admin.clusterAdmin.ListConsumerGroupOffsets(request.Group, map[string][]int32{request.Topic: partitions})
+	if err != nil {
+		return nil, err
+	}
+
+	var resets []OffsetReset
+	for _, partition := range partitions {
+		reset := OffsetReset{
+			Topic:     request.Topic,
+			Partition: partition,
+			Current:   -1,
+		}
+
+		if block := committed.GetBlock(request.Topic, partition); block != nil && block.Err == sarama.ErrNoError {
+			reset.Current = block.Offset
+		}
+
+		if reset.Target, err = admin.resetTarget(request, partition, reset.Current); err != nil {
+			return nil, err
+		}
+		resets = append(resets, reset)
+	}
+
+	sort.Slice(resets, func(i, j int) bool {
+		return resets[i].Partition < resets[j].Partition
+	})
+
+	if request.DryRun {
+		return resets, nil
+	}
+
+	return resets, admin.commitOffsets(request.Group, resets)
+}
+
+func (admin *Admin) resetTarget(request OffsetResetRequest, partition int32, current int64) (int64, error) {
+	var target int64
+
+	low, err := admin.client.GetOffset(request.Topic, partition, sarama.OffsetOldest)
+	if err != nil {
+		return 0, err
+	}
+
+	high, err := admin.client.GetOffset(request.Topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return 0, err
+	}
+
+	switch request.Mode {
+	case ResetToEarliest:
+		target = low
+	case ResetToLatest:
+		target = high
+	case ResetToTimestamp:
+		if target, err = admin.client.GetOffset(request.Topic, partition, request.Timestamp); err != nil {
+			return 0, err
+		}
+
+		// no message after the timestamp
+		if target < 0 {
+			target = high
+		}
+	case ResetToOffset:
+		target = request.Offset
+	case ResetShiftBy:
+		if current < 0 {
+			current = low
+		}
+		target = current + request.Offset
+	default:
+		return 0, fmt.Errorf("unknown reset mode: %d", request.Mode)
+	}
+
+	if target < low {
+		target = low
+	}
+
+	if target > high {
+		target = high
+	}
+
+	return target, nil
+}
+
+// commitOffsets commits offsets on behalf of the group. The consumer does not subscribe, so it does not join the group.
+func (admin *Admin) commitOffsets(group string, resets []OffsetReset) error {
+	consumer, err := kafka.NewConsumer(&kafka.ConfigMap{
+		"bootstrap.servers":  strings.Join(admin.configure.Config.KafkaServers(), ","),
+		"group.id":           group,
+		"enable.auto.commit": false,
+	})
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := consumer.Close(); err != nil {
+			log.Warnf("Kafka admin: failed to close offsets consumer: %s", err.Error())
+		}
+	}()
+
+	offsets := make([]kafka.TopicPartition, 0, len(resets))
+	for i := range resets {
+		offsets = append(offsets, kafka.TopicPartition{
+			Topic:     &resets[i].Topic,
+			Partition: resets[i].Partition,
+			Offset:    kafka.Offset(resets[i].Target),
+		})
+	}
+
+	committed, err := consumer.CommitOffsets(offsets)
+	if err != nil {
+		return err
+	}
+
+	for _, partition := range committed {
+		if partition.Error != nil {
+			return partition.Error
+		}
+	}
+
+	log.Infof("Kafka admin: reset offsets of group '%s': %v", group, resets)
+	return nil
+}
@@ -2,7 +2,12 @@ package provider
 
 import (
 	"backend/config"
+	"backend/health"
+	"backend/ingest"
+	"backend/metrics"
 	"backend/store"
+	"context"
+	"errors"
 	"strings"
 	"time"
 
@@ -12,14 +17,32 @@ import (
 
 var topics = []string{"^choreographer.*", "^.*domain"}
 
+var errNoClusterID = errors.New("the kafka cluster has no id, set KAFKA_CLUSTER")
+
+const (
+	pollTimeout       = 100 * time.Millisecond
+	maxReconnectDelay = 30 * time.Second
+	clusterIDTimeout  = 10 * time.Second
+	drainInterval     = 50 * time.Millisecond
+	// the consumer pauses when the ingest queue is filled up to the pause ratio and resumes below the resume ratio
+	pauseRatio  = 0.8
+	resumeRatio = 0.2
+)
+
 type Service interface {
 	Serve()
-	Stop()
+	Stop(ctx context.Context)
 }
 
 type Provider struct {
-	configure *config.Configure `di.inject:"appConfigure"`
-	consumer  *kafka.Consumer
+	configure     *config.Configure     `di.inject:"appConfigure"`
+	healthSvc     *health.Health        `di.inject:"health"`
+	ingestSvc     *ingest.Metrics       `di.inject:"ingestMetrics"`
+	storedOffsets *ingest.StoredOffsets `di.inject:"storedOffsets"`
+	consumer      *kafka.Consumer
+	paused        []kafka.TopicPartition
+	stop          chan struct{}
+	done          chan struct{}
 }
 
 func (provider *Provider) Serve() {
@@ -29,21 +52,20 @@ func (provider *Provider) Serve() {
 		topicsChan = make(chan interface{})
 	)
 
+	provider.stop = make(chan struct{})
+	provider.done = make(chan struct{})
+
 	go func() {
-		if provider.consumer, err = kafka.NewConsumer(&kafka.ConfigMap{
-			"bootstrap.servers": provider.configure.Config.KafkaHost,
-			"group.id":          provider.configure.Config.KafkaGroup,
-			"auto.offset.reset": "smallest",
-			"topic.blacklist":   "__consumer_offsets",
-		}); err != nil {
-			log.Fatalf("Kafka connection error: %s", err.Error())
+		defer close(provider.done)
+
+		if !provider.connect() {
+			return
 		}
-		defer provider.close()
 
 		provider.listenNewTopics(topicsChan)
 
-		if err = provider.consumer.SubscribeTopics(topics, nil); err != nil {
-			log.Fatalf("Kafka: failed to subscribe on topics - '%s'. Err: %s", topics, err.Error())
+		if !provider.subscribe() {
+			return
 		}
 
 		for {
@@ -52,14 +74,28 @@ func (provider *Provider) Serve() {
 			case <-provider.configure.GlobalContext.Done():
 				return
 
+			case <-provider.stop:
+				return
+
 			case <-topicsChan:
+				// partitions are assigned again unpaused after the subscription
+				provider.paused = nil
+				provider.ingestSvc.SetPaused(false)
 				_ = provider.consumer.Unsubscribe()
-				if err = provider.consumer.SubscribeTopics(topics, nil); err != nil {
-					log.Fatalf("Kafka: failed to subscribe on topics - '%s'. Err: %s", topics, err.Error())
+				if !provider.subscribe() {
+					return
 				}
 
 			default:
-				if message, err = provider.consumer.ReadMessage(-1); err != nil {
+				provider.commitStored()
+				provider.applyBackpressure()
+
+				if message, err = provider.consumer.ReadMessage(pollTimeout); err != nil {
+					if kafkaErr, ok := err.(kafka.Error); ok && kafkaErr.Code() == kafka.ErrTimedOut {
+						continue
+					}
+
+					metrics.KafkaErrors.WithLabelValues("read").Inc()
 					log.Warnf("Kafka read message: %s", err.Error())
 					if strings.Contains(strings.ToLower(err.Error()), strings.ToLower("subscribed topic not available")) {
 						topicsChan <- 1
@@ -67,16 +103,212 @@ func (provider *Provider) Serve() {
 					continue
 				}
 				provider.configure.ServeWriteChannel() <- store.New(*message)
+				provider.ingestSvc.AddConsumed(1)
+				metrics.ConsumedMessages.WithLabelValues(*message.TopicPartition.Topic).Inc()
 			}
 		}
 	}()
 }
 
-func (provider *Provider) Stop() {
+// connect creates the consumer. It retries with the backoff and returns false when the application stops first.
+func (provider *Provider) connect() bool {
+	for retry := time.Second; ; retry = minDuration(2*retry, maxReconnectDelay) {
+		consumer, err := kafka.NewConsumer(&kafka.ConfigMap{
+			"bootstrap.servers": provider.configure.Config.KafkaHost,
+			"group.id":          provider.configure.Config.KafkaGroup,
+			"auto.offset.reset": "smallest",
+			// offsets are committed after the store acknowledges the messages
+			"enable.auto.commit":       false,
+			"enable.auto.offset.store": false,
+			"topic.blacklist":          "__consumer_offsets",
+		})
+		if err == nil {
+			provider.consumer = consumer
+			return true
+		}
+
+		metrics.KafkaErrors.WithLabelValues("connect").Inc()
+		provider.healthSvc.Down(health.Consumer, err)
+		log.Errorf("Kafka connection error: %s. Retry in %s", err.Error(), retry)
+
+		if !provider.wait(retry) {
+			return false
+		}
+	}
+}
+
+// subscribe subscribes the consumer on the topics. It retries with the backoff and returns false when the application
+// stops first.
+func (provider *Provider) subscribe() bool {
+	for retry := time.Second; ; retry = minDuration(2*retry, maxReconnectDelay) {
+		err := provider.resolveCluster()
+		if err == nil {
+			err = provider.consumer.SubscribeTopics(topics, nil)
+		}
+		if err == nil {
+			provider.healthSvc.Up(health.Consumer)
+			return true
+		}
+
+		metrics.KafkaErrors.WithLabelValues("subscribe").Inc()
+		provider.healthSvc.Down(health.Consumer, err)
+		log.Errorf("Kafka: failed to subscribe on topics - '%s'. Err: %s. Retry in %s", topics, err.Error(), retry)
+
+		if !provider.wait(retry) {
+			return false
+		}
+	}
+}
+
+// resolveCluster reads the cluster id which names the cluster in the stored message keys without KAFKA_CLUSTER.
+// Messages are not consumed before the cluster is named.
+func (provider *Provider) resolveCluster() error {
+	if provider.configure.ClusterName() != "" {
+		return nil
+	}
+
+	admin, err := kafka.NewAdminClientFromConsumer(provider.consumer)
+	if err != nil {
+		return err
+	}
+	defer admin.Close()
+
+	ctx, cancel := context.WithTimeout(provider.configure.GlobalContext, clusterIDTimeout)
+	defer cancel()
+
+	id, err := admin.ClusterID(ctx)
+	if err != nil {
+		return err
+	}
+
+	if id == "" {
+		return errNoClusterID
+	}
+
+	log.Infof("Kafka: cluster id %s names the stored messages", id)
+	provider.configure.SetClusterID(id)
+	return nil
+}
+
+func (provider *Provider) wait(delay time.Duration) bool {
+	select {
+	case <-provider.configure.GlobalContext.Done():
+		return false
+	case <-provider.stop:
+		return false
+	case <-time.After(delay):
+		return true
+	}
+}
+
+func minDuration(left, right time.Duration) time.Duration {
+	if left < right {
+		return left
+	}
+	return right
+}
+
+// applyBackpressure pauses the assigned partitions while the store falls behind and resumes them when it catches up.
+func (provider *Provider) applyBackpressure() {
+	var (
+		snapshot = provider.ingestSvc.Snapshot()
+		depth    = float64(snapshot.QueueDepth)
+		capacity = float64(snapshot.QueueCapacity)
+	)
+
+	if capacity == 0 {
+		return
+	}
+
+	if provider.paused == nil && depth >= capacity*pauseRatio {
+		assignment, err := provider.consumer.Assignment()
+		if err != nil || len(assignment) == 0 {
+			return
+		}
+
+		if err = provider.consumer.Pause(assignment); err != nil {
+			metrics.KafkaErrors.WithLabelValues("pause").Inc()
+			log.Warnf("Kafka: failed to pause partitions: %s", err.Error())
+			return
+		}
+
+		log.Infof("Kafka: pause %d partitions, ingest queue depth %d", len(assignment), snapshot.QueueDepth)
+		provider.paused = assignment
+		provider.ingestSvc.SetPaused(true)
+		return
+	}
+
+	if provider.paused != nil && depth <= capacity*resumeRatio {
+		if err := provider.consumer.Resume(provider.paused); err != nil {
+			metrics.KafkaErrors.WithLabelValues("resume").Inc()
+			log.Warnf("Kafka: failed to resume partitions: %s", err.Error())
+		}
+
+		log.Infof("Kafka: resume %d partitions, ingest queue depth %d", len(provider.paused), snapshot.QueueDepth)
+		provider.paused = nil
+		provider.ingestSvc.SetPaused(false)
+	}
+}
+
+// Stop stops the consumption, waits until the store acknowledges the consumed messages and commits their offsets.
+func (provider *Provider) Stop(ctx context.Context) {
+	close(provider.stop)
+
+	select {
+	case <-provider.done:
+	case <-ctx.Done():
+		return
+	}
+
+	if provider.consumer == nil {
+		return
+	}
+
+	provider.drain(ctx)
+	provider.close()
+}
+
+// drain waits until the store acknowledges the consumed messages.
+func (provider *Provider) drain(ctx context.Context) {
+	ticker := time.NewTicker(drainInterval)
+	defer ticker.Stop()
+
+	for provider.ingestSvc.InFlight() > 0 {
+		select {
+		case <-ctx.Done():
+			log.Warnf("Kafka: %d consumed messages are not stored before the shutdown", provider.ingestSvc.InFlight())
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// commitStored commits the next offsets after the messages which the store acknowledged.
+func (provider *Provider) commitStored() {
+	offsets := provider.storedOffsets.Take()
+	if len(offsets) == 0 {
+		return
+	}
+
+	partitions := make([]kafka.TopicPartition, 0, len(offsets))
+	for key, offset := range offsets {
+		topic := key.Topic
+		partitions = append(partitions, kafka.TopicPartition{Topic: &topic, Partition: key.Partition, Offset: kafka.Offset(offset + 1)})
+	}
+
+	if _, err := provider.consumer.CommitOffsets(partitions); err != nil {
+		metrics.KafkaErrors.WithLabelValues("commit").Inc()
+		log.Warnf("Kafka: failed to commit offsets: %s", err.Error())
+		// committed again with the next acknowledged messages
+		for key, offset := range offsets {
+			provider.storedOffsets.Mark(key.Topic, key.Partition, offset)
+		}
+	}
 }
 
 func (provider *Provider) close() {
 	log.Info("Kafka: close connection....")
+	provider.commitStored()
 	if err := provider.consumer.Unsubscribe(); err != nil {
 		log.Warnf("Kafka: Failed unsubscribe: %s", err.Error())
 	}
@@ -94,7 +326,7 @@ func (provider *Provider) listenNewTopics(topicChan chan interface{}) {
 		for {
 			select {
 			case <-timer.C:
-				meta, err := provider.consumer.GetMetadata(nil, true, 3000)
+				meta, err := provider.consumer.GetMetadata(nil, true, metadataTimeoutMs)
 				if err != nil {
 					return
 				}
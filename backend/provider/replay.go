@@ -0,0 +1,222 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"backend/store"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+const (
+	replayProgressInterval = time.Second
+	replayFlushTimeoutMs   = 30000
+	queueFullWaitMs        = 100
+	// MaxReplayRate is the highest rate limit of the replay in messages per second
+	MaxReplayRate = 100000
+)
+
+var ErrReplayRate = fmt.Errorf("rate must be between 0 and %d messages per second", MaxReplayRate)
+
+// ReplaySource calls the function for every message to replay.
+type ReplaySource func(fn func(store.Message) error) error
+
+type ReplayRequest struct {
+	// TargetTopic receives the messages, without it every message goes back to its own topic
+	TargetTopic string
+	// Key rewrites the message keys unless it is nil, DropKey produces the messages without keys
+	Key     *string
+	DropKey bool
+	// Headers are set on every message after the original headers are kept or dropped
+	Headers           map[string]string
+	DropHeaders       bool
+	PreservePartition bool
+	// PreserveTimestamp produces the messages with their original timestamps, otherwise with the current time
+	PreserveTimestamp bool
+	// RatePerSecond limits the produced messages, 0 is unlimited
+	RatePerSecond int
+	DryRun        bool
+}
+
+type ReplayProgress struct {
+	ID       string
+	Read     int64
+	Produced int64
+	Failed   int64
+	DryRun   bool
+	Done     bool
+	Error    string
+}
+
+// Replay produces the messages of the source to kafka. The progress is reported every second and when the replay
+// is done. The dry run only reads the source and counts the messages.
+func (admin *Admin) Replay(ctx context.Context, request ReplayRequest, source ReplaySource, progress func(ReplayProgress)) error {
+	var (
+		producer *kafka.Producer
+		err      error
+		state    = ReplayProgress{ID: uuid.New().String(), DryRun: request.DryRun}
+		produced int64
+		failed   int64
+		limiter  <-chan time.Time
+		lastSent = time.Now()
+	)
+
+	if request.RatePerSecond < 0 || request.RatePerSecond > MaxReplayRate {
+		return ErrReplayRate
+	}
+
+	if !request.DryRun {
+		if err = admin.checkEnabled(); err != nil {
+			return err
+		}
+
+		if producer, err = kafka.NewProducer(&kafka.ConfigMap{
+			"bootstrap.servers": strings.Join(admin.configure.Config.KafkaServers(), ","),
+		}); err != nil {
+			return err
+		}
+		defer producer.Close()
+
+		go func() {
+			for event := range producer.Events() {
+				if delivered, ok := event.(*kafka.Message); ok {
+					if delivered.TopicPartition.Error != nil {
+						log.Warnf("Replay %s: delivery error: %s", state.ID, delivered.TopicPartition.Error.Error())
+						atomic.AddInt64(&failed, 1)
+					} else {
+						atomic.AddInt64(&produced, 1)
+					}
+				}
+			}
+		}()
+	}
+
+	if request.RatePerSecond > 0 && !request.DryRun {
+		ticker := time.NewTicker(replayInterval(request.RatePerSecond))
+		defer ticker.Stop()
+		limiter = ticker.C
+	}
+
+	report := func(done bool) {
+		state.Produced, state.Failed, state.Done = atomic.LoadInt64(&produced), atomic.LoadInt64(&failed), done
+		progress(state)
+	}
+
+	log.Infof("Replay %s: start to '%s', dry run: %t", state.ID, request.TargetTopic, request.DryRun)
+
+	err = source(func(message store.Message) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		state.Read++
+		if request.DryRun {
+			return nil
+		}
+
+		if limiter != nil {
+			select {
+			case <-limiter:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		for {
+			err := producer.Produce(replayMessage(request, message), nil)
+			if kafkaErr, ok := err.(kafka.Error); ok && kafkaErr.Code() == kafka.ErrQueueFull {
+				// wait for the deliveries to free the producer queue
+				producer.Flush(queueFullWaitMs)
+				continue
+			}
+
+			if err != nil {
+				return fmt.Errorf("produce message %s/%d/%d: %w", message.Topic, message.Partition, message.Offset, err)
+			}
+			break
+		}
+
+		if time.Since(lastSent) >= replayProgressInterval {
+			lastSent = time.Now()
+			report(false)
+		}
+		return nil
+	})
+
+	if producer != nil {
+		if remaining := producer.Flush(replayFlushTimeoutMs); remaining > 0 {
+			log.Warnf("Replay %s: %d messages are not delivered", state.ID, remaining)
+			atomic.AddInt64(&failed, int64(remaining))
+		}
+	}
+
+	if err != nil {
+		state.Error = err.Error()
+	}
+	report(true)
+
+	log.Infof("Replay %s: read %d, produced %d, failed %d messages", state.ID, state.Read, state.Produced, state.Failed)
+	return err
+}
+
+// replayInterval is the pause between the produced messages for the rate, never shorter than a nanosecond.
+func replayInterval(ratePerSecond int) time.Duration {
+	if interval := time.Second / time.Duration(ratePerSecond); interval > 0 {
+		return interval
+	}
+	return time.Nanosecond
+}
+
+func replayMessage(request ReplayRequest, message store.Message) *kafka.Message {
+	var (
+		topic     = message.Topic
+		partition = kafka.PartitionAny
+		key       = message.Key
+		headers   []kafka.Header
+	)
+
+	if request.TargetTopic != "" {
+		topic = request.TargetTopic
+	}
+
+	if request.PreservePartition {
+		partition = int32(message.Partition)
+	}
+
+	if request.DropKey {
+		key = nil
+	} else if request.Key != nil {
+		key = []byte(*request.Key)
+	}
+
+	if !request.DropHeaders {
+		for _, header := range message.Headers {
+			if _, ok := request.Headers[header.Key]; !ok {
+				headers = append(headers, kafka.Header{Key: header.Key, Value: header.Value})
+			}
+		}
+	}
+
+	for key, value := range request.Headers {
+		headers = append(headers, kafka.Header{Key: key, Value: []byte(value)})
+	}
+
+	timestamp := time.Now()
+	if request.PreserveTimestamp {
+		timestamp = message.At
+	}
+
+	return &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: partition},
+		Key:            key,
+		Value:          message.Message,
+		Headers:        headers,
+		Timestamp:      timestamp,
+	}
+}
@@ -0,0 +1,158 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"backend/store"
+)
+
+func TestReplayMessage(t *testing.T) {
+	var (
+		at      = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		key     = "new-key"
+		message = store.Message{
+			Topic:     "orders",
+			Partition: 3,
+			Offset:    42,
+			At:        at,
+			Key:       []byte("key"),
+			Message:   []byte("value"),
+			Headers:   []store.Header{{Key: "trace", Value: []byte("1")}, {Key: "source", Value: []byte("a")}},
+		}
+	)
+
+	tests := []struct {
+		name      string
+		request   ReplayRequest
+		topic     string
+		partition int32
+		key       string
+		headers   map[string]string
+		preserved bool
+	}{
+		{
+			name:      "defaults",
+			topic:     "orders",
+			partition: -1,
+			key:       "key",
+			headers:   map[string]string{"trace": "1", "source": "a"},
+		},
+		{
+			name:      "target topic and partition",
+			request:   ReplayRequest{TargetTopic: "orders-retry", PreservePartition: true, PreserveTimestamp: true},
+			topic:     "orders-retry",
+			partition: 3,
+			key:       "key",
+			headers:   map[string]string{"trace": "1", "source": "a"},
+			preserved: true,
+		},
+		{
+			name:      "rewritten key and headers",
+			request:   ReplayRequest{Key: &key, Headers: map[string]string{"source": "replay"}},
+			topic:     "orders",
+			partition: -1,
+			key:       "new-key",
+			headers:   map[string]string{"trace": "1", "source": "replay"},
+		},
+		{
+			name:      "dropped key and headers",
+			request:   ReplayRequest{DropKey: true, DropHeaders: true, Headers: map[string]string{"replayed": "true"}},
+			topic:     "orders",
+			partition: -1,
+			headers:   map[string]string{"replayed": "true"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			produced := replayMessage(test.request, message)
+
+			if *produced.TopicPartition.Topic != test.topic || produced.TopicPartition.Partition != test.partition {
+				t.Errorf("topic partition: got %s/%d", *produced.TopicPartition.Topic, produced.TopicPartition.Partition)
+			}
+
+			if string(produced.Key) != test.key {
+				t.Errorf("key: got %q, want %q", produced.Key, test.key)
+			}
+
+			if string(produced.Value) != "value" {
+				t.Errorf("value: got %q", produced.Value)
+			}
+
+			headers := make(map[string]string)
+			for _, header := range produced.Headers {
+				if _, ok := headers[header.Key]; ok {
+					t.Errorf("header %s is duplicated", header.Key)
+				}
+				headers[header.Key] = string(header.Value)
+			}
+
+			if len(headers) != len(test.headers) {
+				t.Errorf("headers: got %v, want %v", headers, test.headers)
+			}
+			for key, value := range test.headers {
+				if headers[key] != value {
+					t.Errorf("header %s: got %q, want %q", key, headers[key], value)
+				}
+			}
+
+			if produced.Timestamp.Equal(at) != test.preserved {
+				t.Errorf("timestamp: got %s, preserved %t", produced.Timestamp, test.preserved)
+			}
+		})
+	}
+}
+
+func TestReplayInterval(t *testing.T) {
+	tests := []struct {
+		rate     int
+		interval time.Duration
+	}{
+		{rate: 1, interval: time.Second},
+		{rate: 100, interval: 10 * time.Millisecond},
+		{rate: MaxReplayRate, interval: 10 * time.Microsecond},
+		{rate: 2000000000, interval: time.Nanosecond},
+	}
+
+	for _, test := range tests {
+		if got := replayInterval(test.rate); got != test.interval {
+			t.Errorf("rate %d: got %s, want %s", test.rate, got, test.interval)
+		}
+	}
+}
+
+func TestReplayRate(t *testing.T) {
+	var (
+		admin  = &Admin{}
+		source = func(fn func(store.Message) error) error {
+			for i := 0; i < 3; i++ {
+				if err := fn(store.Message{Topic: "orders", Offset: i}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	)
+
+	for _, rate := range []int{-1, MaxReplayRate + 1, 2000000000} {
+		err := admin.Replay(context.Background(), ReplayRequest{DryRun: true, RatePerSecond: rate}, source, func(ReplayProgress) {})
+		if !errors.Is(err, ErrReplayRate) {
+			t.Errorf("rate %d: got %v, want %v", rate, err, ErrReplayRate)
+		}
+	}
+
+	var last ReplayProgress
+	err := admin.Replay(context.Background(), ReplayRequest{DryRun: true, RatePerSecond: MaxReplayRate}, source, func(progress ReplayProgress) {
+		last = progress
+	})
+	if err != nil {
+		t.Fatalf("dry run: %s", err.Error())
+	}
+
+	if !last.Done || !last.DryRun || last.Read != 3 || last.Produced != 0 {
+		t.Errorf("dry run progress: got %+v", last)
+	}
+}
@@ -0,0 +1,226 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+const adminTimeout = 30 * time.Second
+
+var ErrAdminDisabled = errors.New("admin actions are disabled")
+
+type TopicSpec struct {
+	Topic             string
+	Partitions        int
+	ReplicationFactor int
+	Configs           map[string]string
+}
+
+type TopicConfigEntry struct {
+	Name        string
+	Value       string
+	Source      string
+	IsDefault   bool
+	IsReadOnly  bool
+	IsSensitive bool
+}
+
+func (admin *Admin) CreateTopic(spec TopicSpec) error {
+	if err := admin.checkEnabled(); err != nil {
+		return err
+	}
+
+	return admin.withAdminClient(func(ctx context.Context, client *kafka.AdminClient) error {
+		results, err := client.CreateTopics(ctx, []kafka.TopicSpecification{{
+			Topic:             spec.Topic,
+			NumPartitions:     spec.Partitions,
+			ReplicationFactor: spec.ReplicationFactor,
+			Config:            spec.Configs,
+		}}, kafka.SetAdminOperationTimeout(adminTimeout))
+		if err != nil {
+			return err
+		}
+
+		log.Infof("Kafka admin: create topic '%s' with %d partitions", spec.Topic, spec.Partitions)
+		return topicResultsError(results)
+	})
+}
+
+func (admin *Admin) DeleteTopic(topic string) error {
+	if err := admin.checkEnabled(); err != nil {
+		return err
+	}
+
+	return admin.withAdminClient(func(ctx context.Context, client *kafka.AdminClient) error {
+		results, err := client.DeleteTopics(ctx, []string{topic}, kafka.SetAdminOperationTimeout(adminTimeout))
+		if err != nil {
+			return err
+		}
+
+		log.Infof("Kafka admin: delete topic '%s'", topic)
+		return topicResultsError(results)
+	})
+}
+
+// CreatePartitions increases the partition count of the topic up to the total.
+func (admin *Admin) CreatePartitions(topic string, total int) error {
+	if err := admin.checkEnabled(); err != nil {
+		return err
+	}
+
+	return admin.withAdminClient(func(ctx context.Context, client *kafka.AdminClient) error {
+		results, err := client.CreatePartitions(ctx, []kafka.PartitionsSpecification{{
+			Topic:      topic,
+			IncreaseTo: total,
+		}}, kafka.SetAdminOperationTimeout(adminTimeout))
+		if err != nil {
+			return err
+		}
+
+		log.Infof("Kafka admin: increase partitions of topic '%s' to %d", topic, total)
+		return topicResultsError(results)
+	})
+}
+
+func (admin *Admin) TopicConfig(topic string) (entries []TopicConfigEntry, err error) {
+	err = admin.withAdminClient(func(ctx context.Context, client *kafka.AdminClient) error {
+		configs, err := admin.describeTopicConfig(ctx, client, topic)
+		if err != nil {
+			return err
+		}
+
+		for _, config := range configs {
+			entries = append(entries, TopicConfigEntry{
+				Name:        config.Name,
+				Value:       config.Value,
+				Source:      config.Source.String(),
+				IsDefault:   config.Source == kafka.ConfigSourceDefault,
+				IsReadOnly:  config.IsReadOnly,
+				IsSensitive: config.IsSensitive,
+			})
+		}
+		return nil
+	})
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+
+	return entries, err
+}
+
+// AlterTopicConfig sets the configs of the topic. AlterConfigs replaces the whole topic config, so the configs
+// which are already overridden on the topic are sent together with the new ones.
+func (admin *Admin) AlterTopicConfig(topic string, configs map[string]string) error {
+	if err := admin.checkEnabled(); err != nil {
+		return err
+	}
+
+	return admin.withAdminClient(func(ctx context.Context, client *kafka.AdminClient) error {
+		current, err := admin.describeTopicConfig(ctx, client, topic)
+		if err != nil {
+			return err
+		}
+
+		merged := map[string]string{}
+		for name, config := range current {
+			if config.Source == kafka.ConfigSourceDynamicTopic {
+				merged[name] = config.Value
+			}
+		}
+
+		for name, value := range configs {
+			merged[name] = value
+		}
+
+		results, err := client.AlterConfigs(ctx, []kafka.ConfigResource{{
+			Type:   kafka.ResourceTopic,
+			Name:   topic,
+			Config: kafka.StringMapToConfigEntries(merged, kafka.AlterOperationSet),
+		}}, kafka.SetAdminRequestTimeout(adminTimeout))
+		if err != nil {
+			return err
+		}
+
+		for _, result := range results {
+			if result.Error.Code() != kafka.ErrNoError {
+				return result.Error
+			}
+		}
+
+		log.Infof("Kafka admin: alter configs of topic '%s': %v", topic, configs)
+		return nil
+	})
+}
+
+func (admin *Admin) describeTopicConfig(ctx context.Context, client *kafka.AdminClient, topic string) (map[string]kafka.ConfigEntryResult, error) {
+	results, err := client.DescribeConfigs(ctx, []kafka.ConfigResource{{
+		Type: kafka.ResourceTopic,
+		Name: topic,
+	}}, kafka.SetAdminRequestTimeout(adminTimeout))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(results) == 0 {
+		return nil, fmt.Errorf("no config for topic '%s'", topic)
+	}
+
+	if results[0].Error.Code() != kafka.ErrNoError {
+		return nil, results[0].Error
+	}
+
+	return results[0].Config, nil
+}
+
+func (admin *Admin) withAdminClient(action func(ctx context.Context, client *kafka.AdminClient) error) error {
+	client, err := admin.connectAdminClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(admin.configure.GlobalContext, adminTimeout)
+	defer cancel()
+
+	return action(ctx, client)
+}
+
+func (admin *Admin) connectAdminClient() (*kafka.AdminClient, error) {
+	var err error
+
+	admin.mutex.Lock()
+	defer admin.mutex.Unlock()
+
+	if admin.adminClient != nil {
+		return admin.adminClient, nil
+	}
+
+	admin.adminClient, err = kafka.NewAdminClient(&kafka.ConfigMap{
+		"bootstrap.servers": strings.Join(admin.configure.Config.KafkaServers(), ","),
+	})
+
+	return admin.adminClient, err
+}
+
+func (admin *Admin) checkEnabled() error {
+	if !admin.configure.Config.AdminEnabled {
+		return ErrAdminDisabled
+	}
+	return nil
+}
+
+func topicResultsError(results []kafka.TopicResult) error {
+	for _, result := range results {
+		if result.Error.Code() != kafka.ErrNoError {
+			return result.Error
+		}
+	}
+	return nil
+}
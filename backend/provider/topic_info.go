@@ -0,0 +1,89 @@
+package provider
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"backend/store"
+
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+const metadataTimeoutMs = 3000
+
+var errNotConnected = errors.New("kafka consumer is not connected")
+
+type PartitionInfo struct {
+	Partition int32
+	Leader    int32
+	Replicas  []int32
+	Isr       []int32
+	Low       int64
+	High      int64
+}
+
+type TopicInfo struct {
+	Topic      string
+	Partitions []PartitionInfo
+}
+
+// TopicInfo returns partitions, replicas and watermarks of the topic. An empty topic returns all topics of the cluster.
+func (provider *Provider) TopicInfo(topic string) ([]TopicInfo, error) {
+	var (
+		meta *kafka.Metadata
+		err  error
+	)
+
+	if provider.consumer == nil {
+		return nil, errNotConnected
+	}
+
+	if topic == "" {
+		meta, err = provider.consumer.GetMetadata(nil, true, metadataTimeoutMs)
+	} else {
+		meta, err = provider.consumer.GetMetadata(&topic, false, metadataTimeoutMs)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var result []TopicInfo
+	for name, topicMeta := range meta.Topics {
+		if strings.Contains(name, store.SkipTopics) {
+			continue
+		}
+
+		if topicMeta.Error.Code() != kafka.ErrNoError {
+			return nil, topicMeta.Error
+		}
+
+		info := TopicInfo{Topic: name}
+		for _, partitionMeta := range topicMeta.Partitions {
+			low, high, err := provider.consumer.QueryWatermarkOffsets(name, partitionMeta.ID, metadataTimeoutMs)
+			if err != nil {
+				return nil, err
+			}
+
+			info.Partitions = append(info.Partitions, PartitionInfo{
+				Partition: partitionMeta.ID,
+				Leader:    partitionMeta.Leader,
+				Replicas:  partitionMeta.Replicas,
+				Isr:       partitionMeta.Isrs,
+				Low:       low,
+				High:      high,
+			})
+		}
+		sort.Slice(info.Partitions, func(i, j int) bool {
+			return info.Partitions[i].Partition < info.Partitions[j].Partition
+		})
+		result = append(result, info)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Topic < result[j].Topic
+	})
+
+	return result, nil
+}
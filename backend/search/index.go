@@ -0,0 +1,208 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const snippetRadius = 40
+
+type field struct {
+	name string
+	text string
+}
+
+type document struct {
+	seq       uint64
+	key       string
+	topic     string
+	partition int
+	offset    int
+	at        time.Time
+	fields    []field
+	tokens    []string
+}
+
+// index is an inverted index of tokens to the documents ordered by the message time. The sequence of a document is
+// its time in nanoseconds, so the documents indexed late, e.g. on start, take their place by time. The oldest
+// documents are evicted when the index is full.
+type index struct {
+	maxDocuments int
+	postings     map[string][]uint64
+	documents    map[uint64]*document
+	keys         map[string]uint64
+	order        []uint64
+}
+
+func newIndex(maxDocuments int) *index {
+	return &index{
+		maxDocuments: maxDocuments,
+		postings:     make(map[string][]uint64),
+		documents:    make(map[uint64]*document),
+		keys:         make(map[string]uint64),
+	}
+}
+
+// add indexes the document, the document with the same key is replaced.
+func (idx *index) add(doc *document) {
+	if seq, ok := idx.keys[doc.key]; ok {
+		idx.remove(seq)
+	}
+
+	doc.seq = sequence(doc.at)
+	for _, ok := idx.documents[doc.seq]; ok; _, ok = idx.documents[doc.seq] {
+		doc.seq++
+	}
+
+	tokens := map[string]struct{}{}
+	for _, f := range doc.fields {
+		for _, token := range tokenize(f.text) {
+			tokens[token] = struct{}{}
+		}
+	}
+
+	for token := range tokens {
+		doc.tokens = append(doc.tokens, token)
+		idx.postings[token] = insertSorted(idx.postings[token], doc.seq)
+	}
+
+	idx.documents[doc.seq] = doc
+	idx.keys[doc.key] = doc.seq
+	idx.order = insertSorted(idx.order, doc.seq)
+
+	for len(idx.documents) > idx.maxDocuments && len(idx.order) > 0 {
+		idx.remove(idx.order[0])
+	}
+}
+
+func (idx *index) remove(seq uint64) {
+	doc, ok := idx.documents[seq]
+	if !ok {
+		return
+	}
+
+	for _, token := range doc.tokens {
+		if postings := removeSorted(idx.postings[token], seq); len(postings) == 0 {
+			delete(idx.postings, token)
+		} else {
+			idx.postings[token] = postings
+		}
+	}
+
+	idx.order = removeSorted(idx.order, seq)
+	delete(idx.documents, seq)
+	delete(idx.keys, doc.key)
+}
+
+// bounds returns the time of the oldest and the newest indexed documents.
+func (idx *index) bounds() (time.Time, time.Time) {
+	if len(idx.order) == 0 {
+		return time.Time{}, time.Time{}
+	}
+	return idx.documents[idx.order[0]].at, idx.documents[idx.order[len(idx.order)-1]].at
+}
+
+// sequence returns the time in nanoseconds, the times before the epoch come first.
+func sequence(at time.Time) uint64 {
+	if nanos := at.UnixNano(); nanos > 0 {
+		return uint64(nanos)
+	}
+	return 0
+}
+
+// insertSorted inserts the sequence in order. New messages come last, so it is mostly an append.
+func insertSorted(sequences []uint64, seq uint64) []uint64 {
+	if n := len(sequences); n == 0 || sequences[n-1] < seq {
+		return append(sequences, seq)
+	}
+
+	i := sort.Search(len(sequences), func(i int) bool { return sequences[i] >= seq })
+	sequences = append(sequences, 0)
+	copy(sequences[i+1:], sequences[i:])
+	sequences[i] = seq
+	return sequences
+}
+
+func removeSorted(sequences []uint64, seq uint64) []uint64 {
+	i := sort.Search(len(sequences), func(i int) bool { return sequences[i] >= seq })
+	switch {
+	case i == len(sequences) || sequences[i] != seq:
+		return sequences
+	case i == 0:
+		// the evicted oldest document is the first one
+		return sequences[1:]
+	default:
+		return append(sequences[:i], sequences[i+1:]...)
+	}
+}
+
+// search returns the newest documents which contain every token of the text.
+func (idx *index) search(tokens []string, accept func(*document) bool, limit int) []*document {
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	// the shortest posting list drives the intersection
+	sort.Slice(tokens, func(i, j int) bool { return len(idx.postings[tokens[i]]) < len(idx.postings[tokens[j]]) })
+
+	var (
+		result []*document
+		lead   = idx.postings[tokens[0]]
+	)
+
+	for i := len(lead) - 1; i >= 0 && len(result) < limit; i-- {
+		seq := lead[i]
+		if !idx.containsAll(tokens[1:], seq) {
+			continue
+		}
+
+		if doc, ok := idx.documents[seq]; ok && accept(doc) {
+			result = append(result, doc)
+		}
+	}
+
+	return result
+}
+
+func (idx *index) containsAll(tokens []string, seq uint64) bool {
+	for _, token := range tokens {
+		postings := idx.postings[token]
+		i := sort.Search(len(postings), func(i int) bool { return postings[i] >= seq })
+		if i == len(postings) || postings[i] != seq {
+			return false
+		}
+	}
+	return true
+}
+
+// tokenize splits the text to lower case words of letters and digits.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// match returns the first field which contains the phrase and the text around it.
+func (doc *document) match(phrase string) (string, string, bool) {
+	phrase = strings.ToLower(phrase)
+
+	for _, f := range doc.fields {
+		i := strings.Index(strings.ToLower(f.text), phrase)
+		if i < 0 {
+			continue
+		}
+
+		start, end := i-snippetRadius, i+len(phrase)+snippetRadius
+		if start < 0 {
+			start = 0
+		}
+		if end > len(f.text) {
+			end = len(f.text)
+		}
+		return f.name, strings.ToValidUTF8(f.text[start:end], ""), true
+	}
+
+	return "", "", false
+}
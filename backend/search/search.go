@@ -0,0 +1,286 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"backend/config"
+	"backend/decoder"
+	"backend/store"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+	fieldPayload = "payload"
+	fieldHeader  = "header:"
+	// queueSize is the number of the stored batches waiting for the index, the batches over it are not indexed
+	queueSize = 64
+)
+
+var (
+	ErrSearchDisabled = errors.New("search is disabled")
+	ErrEmptyQuery     = errors.New("search query is empty")
+)
+
+type Query struct {
+	Text  string
+	Topic string
+	From  time.Time
+	To    time.Time
+	Limit int
+}
+
+type Result struct {
+	Topic     string
+	Partition int
+	Offset    int
+	At        time.Time
+	Field     string
+	Snippet   string
+}
+
+// Results are the matches of the query and the coverage of the index. The index holds the messages stored between
+// From and To, except the skipped batches, so the older messages and the skipped ones are not found.
+type Results struct {
+	Results []Result
+	From    time.Time
+	To      time.Time
+	// Documents is the number of the indexed messages
+	Documents int
+	// Loading is true until the newest stored messages are indexed on start
+	Loading         bool
+	SkippedBatches  int64
+	SkippedMessages int64
+}
+
+// Search keeps the inverted index of the payload text and the header values of the stored messages. The index is
+// filled with the newest stored messages on start and then with every inserted batch. Batches are indexed from
+// the queue, so the decoding does not slow down the ingest.
+type Search struct {
+	configure  *config.Configure     `di.inject:"appConfigure"`
+	storeSvc   *store.RethinkService `di.inject:"storeService"`
+	decoderSvc *decoder.Decoder      `di.inject:"decoderService"`
+	index      *index
+	mutex      sync.RWMutex
+	queue      chan []store.Consumed
+	stop       chan struct{}
+	loading    int32
+	// skippedBatches and skippedMessages count the stored batches dropped when the queue is full
+	skippedBatches  int64
+	skippedMessages int64
+}
+
+func (search *Search) Serve() {
+	var config = search.configure.Config
+	if !config.SearchEnabled {
+		return
+	}
+
+	search.index = newIndex(config.SearchMaxDocuments)
+	search.queue = make(chan []store.Consumed, queueSize)
+	search.stop = make(chan struct{})
+	search.loading = 1
+	search.storeSvc.AddListener(search)
+
+	go search.serveQueue()
+
+	go func() {
+		var documents []*document
+
+		err := search.storeSvc.RecentMessages(time.Time{}, config.SearchMaxDocuments, func(message store.Message) {
+			documents = append(documents, search.document(message, search.decoderSvc.Decode(message)))
+		})
+		if err != nil {
+			log.Warnf("Search: index stored messages error: %s", err.Error())
+		}
+
+		// the documents of the batches indexed meanwhile are newer
+		search.mutex.Lock()
+		for _, doc := range documents {
+			if _, ok := search.index.keys[doc.key]; !ok {
+				search.index.add(doc)
+			}
+		}
+		search.mutex.Unlock()
+		atomic.StoreInt32(&search.loading, 0)
+
+		log.Infof("Search: indexed %d stored messages", len(documents))
+	}()
+}
+
+func (search *Search) Stop(ctx context.Context) {
+	if search.stop != nil {
+		close(search.stop)
+	}
+}
+
+// Stored queues the inserted messages for the index. The batch is dropped when the index does not keep up.
+func (search *Search) Stored(batch []store.Consumed) {
+	select {
+	case search.queue <- append([]store.Consumed(nil), batch...):
+	default:
+		atomic.AddInt64(&search.skippedBatches, 1)
+		atomic.AddInt64(&search.skippedMessages, int64(len(batch)))
+		log.Warnf("Search: index queue is full, skip %d messages", len(batch))
+	}
+}
+
+func (search *Search) serveQueue() {
+	for {
+		select {
+		case <-search.stop:
+			return
+
+		case <-search.configure.GlobalContext.Done():
+			return
+
+		case batch := <-search.queue:
+			documents := make([]*document, 0, len(batch))
+			for i := range batch {
+				documents = append(documents, search.document(batch[i].Message, search.decoderSvc.DecodeOnce(&batch[i])))
+			}
+
+			search.mutex.Lock()
+			for _, doc := range documents {
+				search.index.add(doc)
+			}
+			search.mutex.Unlock()
+		}
+	}
+}
+
+// Search returns the newest messages which contain the query text in the payload or a header value and the range of
+// the indexed messages.
+func (search *Search) Search(query Query) (Results, error) {
+	if search.index == nil {
+		return Results{}, ErrSearchDisabled
+	}
+
+	tokens := tokenize(query.Text)
+	if len(tokens) == 0 {
+		return Results{}, ErrEmptyQuery
+	}
+
+	if query.Limit <= 0 {
+		query.Limit = defaultLimit
+	} else if query.Limit > maxLimit {
+		query.Limit = maxLimit
+	}
+
+	var (
+		phrase  = strings.TrimSpace(query.Text)
+		results []Result
+	)
+
+	search.mutex.RLock()
+	defer search.mutex.RUnlock()
+
+	search.index.search(tokens, func(doc *document) bool {
+		if query.Topic != "" && doc.topic != query.Topic {
+			return false
+		}
+
+		if (!query.From.IsZero() && doc.at.Before(query.From)) || (!query.To.IsZero() && doc.at.After(query.To)) {
+			return false
+		}
+
+		name, snippet, ok := doc.match(phrase)
+		if !ok {
+			return false
+		}
+
+		results = append(results, Result{
+			Topic:     doc.topic,
+			Partition: doc.partition,
+			Offset:    doc.offset,
+			At:        doc.at,
+			Field:     name,
+			Snippet:   snippet,
+		})
+		return true
+	}, query.Limit)
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].At.After(results[j].At) })
+
+	from, to := search.index.bounds()
+	return Results{
+		Results:         results,
+		From:            from,
+		To:              to,
+		Documents:       len(search.index.documents),
+		Loading:         atomic.LoadInt32(&search.loading) == 1,
+		SkippedBatches:  atomic.LoadInt64(&search.skippedBatches),
+		SkippedMessages: atomic.LoadInt64(&search.skippedMessages),
+	}, nil
+}
+
+func (search *Search) document(message store.Message, payload decoder.Payload) *document {
+	doc := &document{
+		key:       message.PrimaryKey(search.configure.ClusterName()),
+		topic:     message.Topic,
+		partition: message.Partition,
+		offset:    message.Offset,
+		at:        message.At,
+	}
+
+	// binary payloads rendered as base64 are not searchable
+	if payload.Encoding != decoder.EncodingBase64 && payload.Value != nil {
+		doc.fields = append(doc.fields, field{name: fieldPayload, text: search.truncate(payloadText(payload.Value))})
+	}
+
+	for _, header := range message.Headers {
+		if value, encoding := header.Render(); encoding == store.HeaderEncodingUtf8 {
+			doc.fields = append(doc.fields, field{name: fieldHeader + header.Key, text: search.truncate(value)})
+		}
+	}
+
+	return doc
+}
+
+func (search *Search) truncate(text string) string {
+	if max := search.configure.Config.SearchMaxText; len(text) > max {
+		return text[:max]
+	}
+	return text
+}
+
+// payloadText joins the values of the decoded payload.
+func payloadText(value interface{}) string {
+	var builder strings.Builder
+
+	var walk func(value interface{})
+	walk = func(value interface{}) {
+		switch typed := value.(type) {
+		case map[string]interface{}:
+			keys := make([]string, 0, len(typed))
+			for key := range typed {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+
+			for _, key := range keys {
+				walk(typed[key])
+			}
+		case []interface{}:
+			for _, item := range typed {
+				walk(item)
+			}
+		case nil:
+		default:
+			builder.WriteString(fmt.Sprint(typed))
+			builder.WriteByte('\n')
+		}
+	}
+
+	walk(value)
+	return builder.String()
+}
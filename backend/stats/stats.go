@@ -0,0 +1,229 @@
+package stats
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"backend/config"
+	"backend/store"
+)
+
+const (
+	// AllPartitions marks the series of the whole topic
+	AllPartitions     = -1
+	DefaultResolution = "1m"
+)
+
+type resolution struct {
+	name     string
+	duration time.Duration
+	keep     int
+}
+
+// resolutions keep a day of minutes, a week of hours and three months of days
+var resolutions = []resolution{
+	{name: "1m", duration: time.Minute, keep: 24 * 60},
+	{name: "1h", duration: time.Hour, keep: 7 * 24},
+	{name: "1d", duration: 24 * time.Hour, keep: 90},
+}
+
+var ErrUnknownResolution = errors.New("unknown resolution, use 1m, 1h or 1d")
+
+type Bucket struct {
+	Start   time.Time
+	Count   int64
+	Bytes   int64
+	MinSize int
+	MaxSize int
+}
+
+func (bucket Bucket) AvgSize() int64 {
+	if bucket.Count == 0 {
+		return 0
+	}
+	return bucket.Bytes / bucket.Count
+}
+
+func (bucket *Bucket) add(other Bucket) {
+	if bucket.Count == 0 || other.MinSize < bucket.MinSize {
+		bucket.MinSize = other.MinSize
+	}
+	if other.MaxSize > bucket.MaxSize {
+		bucket.MaxSize = other.MaxSize
+	}
+	bucket.Count += other.Count
+	bucket.Bytes += other.Bytes
+}
+
+type Series struct {
+	Topic     string
+	Partition int
+	Buckets   []Bucket
+	// LastMessage is the time of the newest message, an old one points to a stuck producer
+	LastMessage time.Time
+}
+
+type Query struct {
+	Topic       string
+	Resolution  string
+	From        time.Time
+	To          time.Time
+	ByPartition bool
+}
+
+type seriesKey struct {
+	topic     string
+	partition int
+}
+
+type series struct {
+	buckets     map[int64]*Bucket
+	lastMessage time.Time
+}
+
+// Stats aggregates the count and the payload sizes of the inserted messages per topic partition in time buckets
+// of the message time. The buckets are kept in memory only: they start empty on every start of the application.
+// A message is counted once by its offset, the messages consumed again, e.g. after a rebalance or an offsets reset,
+// are skipped.
+type Stats struct {
+	configure *config.Configure     `di.inject:"appConfigure"`
+	storeSvc  *store.RethinkService `di.inject:"storeService"`
+	mutex     sync.RWMutex
+	series    map[string]map[seriesKey]*series
+	// offsets are the newest counted offsets of the topic partitions
+	offsets map[seriesKey]int
+}
+
+func (stats *Stats) Serve() {
+	stats.offsets = make(map[seriesKey]int)
+	stats.series = make(map[string]map[seriesKey]*series, len(resolutions))
+	for _, resolution := range resolutions {
+		stats.series[resolution.name] = make(map[seriesKey]*series)
+	}
+
+	stats.storeSvc.AddListener(stats)
+}
+
+func (stats *Stats) Stop(ctx context.Context) {
+}
+
+// Stored adds the inserted messages to the buckets.
+func (stats *Stats) Stored(batch []store.Consumed) {
+	stats.mutex.Lock()
+	defer stats.mutex.Unlock()
+
+	for _, message := range batch {
+		key := seriesKey{topic: message.Topic, partition: message.Partition}
+
+		if offset, ok := stats.offsets[key]; ok && message.Offset <= offset {
+			continue
+		}
+		stats.offsets[key] = message.Offset
+
+		for _, resolution := range resolutions {
+			current, ok := stats.series[resolution.name][key]
+			if !ok {
+				current = &series{buckets: make(map[int64]*Bucket)}
+				stats.series[resolution.name][key] = current
+			}
+
+			start := message.At.Truncate(resolution.duration)
+			bucket, ok := current.buckets[start.Unix()]
+			if !ok {
+				bucket = &Bucket{Start: start}
+				current.buckets[start.Unix()] = bucket
+				current.prune(resolution)
+			}
+			bucket.add(Bucket{Count: 1, Bytes: int64(message.Size), MinSize: message.Size, MaxSize: message.Size})
+
+			if message.At.After(current.lastMessage) {
+				current.lastMessage = message.At
+			}
+		}
+	}
+}
+
+// prune removes the buckets older than the resolution keeps.
+func (current *series) prune(resolution resolution) {
+	if len(current.buckets) <= resolution.keep {
+		return
+	}
+
+	oldest := time.Now().Add(-time.Duration(resolution.keep) * resolution.duration).Unix()
+	for start := range current.buckets {
+		if start < oldest {
+			delete(current.buckets, start)
+		}
+	}
+}
+
+// Stats returns the series of the topic, of every partition with ByPartition. Without the topic it returns the
+// series of every topic.
+func (stats *Stats) Stats(query Query) ([]Series, error) {
+	if query.Resolution == "" {
+		query.Resolution = DefaultResolution
+	}
+
+	stats.mutex.RLock()
+	defer stats.mutex.RUnlock()
+
+	all, ok := stats.series[query.Resolution]
+	if !ok {
+		return nil, ErrUnknownResolution
+	}
+
+	merged := map[seriesKey]*series{}
+	for key, current := range all {
+		if query.Topic != "" && key.topic != query.Topic {
+			continue
+		}
+
+		if !query.ByPartition {
+			key.partition = AllPartitions
+		}
+
+		target, ok := merged[key]
+		if !ok {
+			target = &series{buckets: make(map[int64]*Bucket)}
+			merged[key] = target
+		}
+
+		for start, bucket := range current.buckets {
+			if (!query.From.IsZero() && bucket.Start.Before(query.From)) || (!query.To.IsZero() && bucket.Start.After(query.To)) {
+				continue
+			}
+
+			if _, ok := target.buckets[start]; !ok {
+				target.buckets[start] = &Bucket{Start: bucket.Start}
+			}
+			target.buckets[start].add(*bucket)
+		}
+
+		if current.lastMessage.After(target.lastMessage) {
+			target.lastMessage = current.lastMessage
+		}
+	}
+
+	result := make([]Series, 0, len(merged))
+	for key, current := range merged {
+		item := Series{Topic: key.topic, Partition: key.partition, LastMessage: current.lastMessage}
+		for _, bucket := range current.buckets {
+			item.Buckets = append(item.Buckets, *bucket)
+		}
+		sort.Slice(item.Buckets, func(i, j int) bool { return item.Buckets[i].Start.Before(item.Buckets[j].Start) })
+
+		result = append(result, item)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Topic != result[j].Topic {
+			return result[i].Topic < result[j].Topic
+		}
+		return result[i].Partition < result[j].Partition
+	})
+
+	return result, nil
+}
@@ -0,0 +1,162 @@
+package store
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var filterFieldTypes = map[castType]string{
+	castString: "topic;at",
+	castNumber: "offset;partition;timestamp;size",
+}
+
+type castType int
+
+const (
+	castString castType = iota
+	castNumber
+)
+
+// FilterParam is the filter of the messages socket command: the message field, the header or the payload path,
+// one of the Operator constants and the value.
+type FilterParam struct {
+	Param    string
+	Operator string
+	Value    string
+}
+
+// NewFilters returns the filters of the message fields, headers and payload paths. The topic parameter selects
+// the topic. Binary header values are compared in the header encoding.
+func NewFilters(params []FilterParam, payloadDecoder PayloadDecoder, headerEncoding string) (result Filters) {
+	if len(params) == 0 {
+		return Filters{}
+	}
+
+	result.Decoder = payloadDecoder
+	result.HeaderEncoding = headerEncoding
+
+	for _, param := range params {
+		if param.Param == "topic" {
+			result.Topic = param.Value
+			continue
+		}
+
+		result.Filters = append(result.Filters, Filter{
+			FieldName:  param.Param,
+			FieldValue: param.Value,
+			Operator:   param.Operator,
+			Comparator: newComparator(param.Operator, filterCastType(param.Param, param.Operator)),
+		})
+	}
+	return
+}
+
+// filterCastType returns the type to compare the field. Payload paths are compared as numbers by the ordering
+// operators and as strings otherwise.
+func filterCastType(fieldName string, operator string) castType {
+	if strings.HasPrefix(fieldName, PayloadPathPrefix) {
+		if operator == OperatorEq || operator == OperatorNe {
+			return castString
+		}
+		return castNumber
+	}
+
+	for t, v := range filterFieldTypes {
+		if strings.Contains(v, strings.ToLower(fieldName)) {
+			return t
+		}
+	}
+	return castString
+}
+
+func newComparator(operator string, cast castType) Comparator {
+	if cast == castNumber {
+		return NumberComparator{operator}
+	}
+	return StringComparator{operator}
+}
+
+type StringComparator struct {
+	operator string
+}
+
+func (stringComparator StringComparator) Compare(left, right interface{}) bool {
+	// payload values may be numbers or booleans
+	leftString, ok := left.(string)
+	if !ok {
+		leftString = fmt.Sprint(left)
+	}
+
+	log.Debugf("String compare: left - %s, right %s", leftString, right.(string))
+
+	switch stringComparator.operator {
+	case OperatorEq:
+		return strings.EqualFold(leftString, right.(string))
+	case OperatorNe:
+		return !strings.EqualFold(leftString, right.(string))
+	default:
+		return true
+	}
+}
+
+type NumberComparator struct {
+	operator string
+}
+
+func (numberComparator NumberComparator) Compare(left, right interface{}) bool {
+	var (
+		err         error
+		leftNumber  float64
+		rightNumber float64
+	)
+
+	// numbers are compared as float64, json payloads decode all numbers to float64
+	if rightNumber, err = strconv.ParseFloat(right.(string), 64); err != nil {
+		log.Debugf("Filter value %v parse error: %s", right, err.Error())
+		return false
+	}
+
+	switch value := left.(type) {
+	case int:
+		leftNumber = float64(value)
+	case int32:
+		leftNumber = float64(value)
+	case int64:
+		leftNumber = float64(value)
+	case uint64:
+		leftNumber = float64(value)
+	case float32:
+		leftNumber = float64(value)
+	case float64:
+		leftNumber = value
+	case string:
+		if leftNumber, err = strconv.ParseFloat(value, 64); err != nil {
+			log.Debugf("Message value %v parse error: %s", left, err.Error())
+			return false
+		}
+	default:
+		return false
+	}
+
+	log.Debugf("Number compare: message value %v, parse value %g, filter value %g", left, leftNumber, rightNumber)
+
+	switch numberComparator.operator {
+	case OperatorEq:
+		return leftNumber == rightNumber
+	case OperatorNe:
+		return leftNumber != rightNumber
+	case OperatorGe:
+		return leftNumber >= rightNumber
+	case OperatorGt:
+		return leftNumber > rightNumber
+	case OperatorLe:
+		return leftNumber <= rightNumber
+	case OperatorLt:
+		return leftNumber < rightNumber
+	default:
+		return true
+	}
+}
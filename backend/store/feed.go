@@ -0,0 +1,242 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	rethink "gopkg.in/rethinkdb/rethinkdb-go.v6"
+
+	"backend/metrics"
+)
+
+const (
+	pushDownFields = "offset;partition;timestamp;size"
+	// SubscriberCapacity is the number of the changes buffered for a socket, the newer changes are dropped
+	SubscriberCapacity = 64
+	feedRetry          = time.Second
+)
+
+// feed is one change feed shared by the sockets which watch the same topic with the same pushed-down predicates.
+type feed struct {
+	key    string
+	term   rethink.Term
+	cancel context.CancelFunc
+	mutex  sync.Mutex
+	// subscribers keep the number of the changes dropped since the last change sent to the subscriber
+	subscribers map[chan FeedMessage]int64
+}
+
+type feeds struct {
+	mutex sync.Mutex
+	feeds map[string]*feed
+}
+
+// subscribe returns the channel with the changes of the filtered messages. The channel is closed by unsubscribe.
+func (rethinkService *RethinkService) subscribe(filters Filters) (string, chan FeedMessage) {
+	var (
+		key, term = changesTerm(filters)
+		msgChan   = make(chan FeedMessage, SubscriberCapacity)
+	)
+
+	rethinkService.feeds.mutex.Lock()
+	defer rethinkService.feeds.mutex.Unlock()
+
+	if rethinkService.feeds.feeds == nil {
+		rethinkService.feeds.feeds = make(map[string]*feed)
+	}
+
+	current, ok := rethinkService.feeds.feeds[key]
+	if !ok {
+		ctx, cancel := context.WithCancel(rethinkService.configure.GlobalContext)
+		current = &feed{key: key, term: term, cancel: cancel, subscribers: make(map[chan FeedMessage]int64)}
+		rethinkService.feeds.feeds[key] = current
+
+		log.Infof("Open change feed: %s", key)
+		metrics.ChangeFeeds.Inc()
+		go rethinkService.serveFeed(ctx, current)
+	}
+
+	current.mutex.Lock()
+	current.subscribers[msgChan] = 0
+	current.mutex.Unlock()
+
+	return key, msgChan
+}
+
+// unsubscribe closes the channel and the feed when it has no subscribers left.
+func (rethinkService *RethinkService) unsubscribe(key string, msgChan chan FeedMessage) {
+	rethinkService.feeds.mutex.Lock()
+	defer rethinkService.feeds.mutex.Unlock()
+
+	current, ok := rethinkService.feeds.feeds[key]
+	if !ok {
+		return
+	}
+
+	current.mutex.Lock()
+	if _, ok = current.subscribers[msgChan]; ok {
+		delete(current.subscribers, msgChan)
+		close(msgChan)
+	}
+	empty := len(current.subscribers) == 0
+	current.mutex.Unlock()
+
+	if empty {
+		log.Infof("Close change feed: %s", key)
+		metrics.ChangeFeeds.Dec()
+		current.cancel()
+		delete(rethinkService.feeds.feeds, key)
+	}
+}
+
+func (rethinkService *RethinkService) serveFeed(ctx context.Context, current *feed) {
+	for {
+		if err := rethinkService.readFeed(ctx, current); err != nil {
+			log.Errorf("RethinkDb change feed %s error: %s", current.key, err.Error())
+			metrics.ChangeFeedErrors.Inc()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(feedRetry):
+		}
+	}
+}
+
+func (rethinkService *RethinkService) readFeed(ctx context.Context, current *feed) error {
+	var (
+		id      uuid.UUID
+		cursor  *rethink.Cursor
+		changes Changes
+		err     error
+	)
+
+	if id, err = rethinkService.connect(true); err != nil {
+		return err
+	}
+	defer rethinkService.close(id)
+
+	if cursor, err = current.term.Changes().Run(rethinkService.getConnection(id)); err != nil {
+		return err
+	}
+	defer cursor.Close()
+
+	// the cursor is closed to stop the blocked Next when the feed is cancelled
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = cursor.Close()
+		case <-done:
+		}
+	}()
+
+	for cursor.Next(&changes) {
+		if changes.NewValue.Topic == "" {
+			// the message was deleted
+			changes = Changes{}
+			continue
+		}
+
+		current.mutex.Lock()
+		for msgChan, dropped := range current.subscribers {
+			message := FeedMessage{Message: changes.NewValue, Dropped: dropped}
+
+			select {
+			case msgChan <- message:
+				current.subscribers[msgChan] = 0
+			default:
+				current.subscribers[msgChan] = dropped + 1
+				log.Debugf("Change feed %s: drop message of slow subscriber", current.key)
+			}
+		}
+		current.mutex.Unlock()
+		changes = Changes{}
+	}
+
+	return cursor.Err()
+}
+
+// changesTerm selects the messages of the topic by the index and pushes down the number field filters.
+// The key identifies the feed among equal filters.
+func changesTerm(filters Filters) (string, rethink.Term) {
+	var (
+		term       = rethink.Table(tableName)
+		predicates []string
+	)
+
+	if filters.Topic != "" {
+		term = term.GetAllByIndex(index, filters.Topic)
+	}
+
+	for _, filter := range filters.Filters {
+		field := strings.ToLower(filter.FieldName)
+		if !isPushDownField(field) {
+			continue
+		}
+
+		value, ok := filter.FieldValue.(string)
+		if !ok {
+			continue
+		}
+
+		number, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		predicate, ok := pushDownPredicate(field, filter.Operator, number)
+		if !ok {
+			continue
+		}
+
+		term = term.Filter(predicate)
+		predicates = append(predicates, fmt.Sprintf("%s %s %d", field, filter.Operator, number))
+	}
+
+	sort.Strings(predicates)
+	return fmt.Sprintf("%s[%s]", filters.Topic, strings.Join(predicates, ",")), term
+}
+
+func isPushDownField(field string) bool {
+	for _, name := range strings.Split(pushDownFields, ";") {
+		if name == field {
+			return true
+		}
+	}
+	return false
+}
+
+func pushDownPredicate(field string, operator string, value int64) (func(rethink.Term) rethink.Term, bool) {
+	var compare func(rethink.Term, int64) rethink.Term
+
+	switch operator {
+	case OperatorEq:
+		compare = func(term rethink.Term, value int64) rethink.Term { return term.Eq(value) }
+	case OperatorNe:
+		compare = func(term rethink.Term, value int64) rethink.Term { return term.Ne(value) }
+	case OperatorGt:
+		compare = func(term rethink.Term, value int64) rethink.Term { return term.Gt(value) }
+	case OperatorGe:
+		compare = func(term rethink.Term, value int64) rethink.Term { return term.Ge(value) }
+	case OperatorLt:
+		compare = func(term rethink.Term, value int64) rethink.Term { return term.Lt(value) }
+	case OperatorLe:
+		compare = func(term rethink.Term, value int64) rethink.Term { return term.Le(value) }
+	default:
+		return nil, false
+	}
+
+	return func(row rethink.Term) rethink.Term {
+		return compare(row.Field(field), value)
+	}, true
+}
@@ -0,0 +1,111 @@
+package store
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	rethink "gopkg.in/rethinkdb/rethinkdb-go.v6"
+)
+
+// Listener is notified about the messages which the store inserted. The batch is reused after the call returns.
+type Listener interface {
+	Stored(batch []Consumed)
+}
+
+// Enricher sets the fields of a consumed message before it is inserted.
+type Enricher interface {
+	Enrich(message *Consumed)
+}
+
+// AddEnricher registers the enricher of the consumed messages.
+func (rethinkService *RethinkService) AddEnricher(enricher Enricher) {
+	rethinkService.listenersMutex.Lock()
+	rethinkService.enrichers = append(rethinkService.enrichers, enricher)
+	rethinkService.listenersMutex.Unlock()
+}
+
+func (rethinkService *RethinkService) enrich(message *Consumed) {
+	rethinkService.listenersMutex.RLock()
+	defer rethinkService.listenersMutex.RUnlock()
+
+	for _, enricher := range rethinkService.enrichers {
+		enricher.Enrich(message)
+	}
+}
+
+// AddListener registers the listener for the inserted messages.
+func (rethinkService *RethinkService) AddListener(listener Listener) {
+	rethinkService.listenersMutex.Lock()
+	rethinkService.listeners = append(rethinkService.listeners, listener)
+	rethinkService.listenersMutex.Unlock()
+}
+
+func (rethinkService *RethinkService) notifyStored(batch []Consumed) {
+	rethinkService.listenersMutex.RLock()
+	defer rethinkService.listenersMutex.RUnlock()
+
+	for _, listener := range rethinkService.listeners {
+		listener.Stored(batch)
+	}
+}
+
+// Correlated returns the stored messages with the correlation id ordered by time.
+func (rethinkService *RethinkService) Correlated(correlation string) ([]Message, error) {
+	var (
+		id       uuid.UUID
+		cursor   *rethink.Cursor
+		messages []Message
+		err      error
+	)
+
+	if id, err = rethinkService.connect(true); err != nil {
+		return nil, err
+	}
+	defer rethinkService.close(id)
+
+	cursor, err = rethink.Table(tableName).GetAllByIndex(correlationIndex, correlation).
+		OrderBy("at", "partition", "offset").
+		Run(rethinkService.getConnection(id))
+	if err != nil {
+		return nil, err
+	}
+
+	err = cursor.All(&messages)
+	return messages, err
+}
+
+// RecentMessages calls the function for the newest stored messages from the newest one, at most limit of them.
+func (rethinkService *RethinkService) RecentMessages(since time.Time, limit int, fn func(Message)) error {
+	var (
+		id      uuid.UUID
+		cursor  *rethink.Cursor
+		message Message
+		err     error
+	)
+
+	if id, err = rethinkService.connect(true); err != nil {
+		return err
+	}
+	defer rethinkService.close(id)
+
+	cursor, err = rethink.Table(tableName).
+		Between(since, rethink.MaxVal, rethink.BetweenOpts{Index: atIndex}).
+		OrderBy(rethink.OrderByOpts{Index: rethink.Desc(atIndex)}).
+		Limit(limit).
+		Run(rethinkService.getConnection(id))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close()
+
+	for cursor.Next(&message) {
+		fn(message)
+		message = Message{}
+	}
+
+	if err = cursor.Err(); err != nil {
+		log.Warnf("Read recent messages error: %s", err.Error())
+	}
+	return err
+}
@@ -2,27 +2,106 @@ package store
 
 import (
 	"bytes"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+	"gopkg.in/rethinkdb/rethinkdb-go.v6/encoding"
 )
 
-const messageFilterFields = "offset;partition;timestamp;at;size;"
+const (
+	messageFilterFields = "offset;partition;timestamp;at;size;"
+	// PayloadPathPrefix starts the filter field which is a dot separated path in the decoded payload
+	PayloadPathPrefix = "payload."
+
+	HeaderEncodingUtf8   = "utf8"
+	HeaderEncodingBase64 = "base64"
+	HeaderEncodingHex    = "hex"
+
+	OperatorEq = "eq"
+	OperatorNe = "ne"
+	OperatorGt = "gt"
+	OperatorGe = "ge"
+	OperatorLt = "lt"
+	OperatorLe = "le"
+)
 
 type Message struct {
-	Topic     string    `rethinkdb:"topic"`
-	Headers   []byte    `rethinkdb:"headers"`
-	Offset    int       `rethinkdb:"offset"`
-	Partition int       `rethinkdb:"partition"`
-	Timestamp int64     `rethinkdb:"timestamp"`
-	At        time.Time `rethinkdb:"at"`
-	Size      int       `rethinkdb:"size"`
-	Message   []byte    `rethinkdb:"message"`
+	ID          string    `rethinkdb:"id,omitempty"`
+	Topic       string    `rethinkdb:"topic"`
+	Key         []byte    `rethinkdb:"key"`
+	Headers     []Header  `rethinkdb:"headerList"`
+	Offset      int       `rethinkdb:"offset"`
+	Partition   int       `rethinkdb:"partition"`
+	Timestamp   int64     `rethinkdb:"timestamp"`
+	At          time.Time `rethinkdb:"at"`
+	Size        int       `rethinkdb:"size"`
+	Message     []byte    `rethinkdb:"message"`
+	Correlation string    `rethinkdb:"correlation,omitempty"`
+}
+
+// FeedMessage is the message pushed to a socket with the state of its change feed, which is not stored.
+type FeedMessage struct {
+	Message
+	// Dropped is the number of the changes which the change feed dropped before the message for the slow socket
+	Dropped int64
+	// History marks the last stored messages sent when the socket subscribes, they are not live
+	History bool
+}
+
+// Consumed is the message on its way through the ingest. Decoded is the payload which an enricher decoded, the
+// listeners reuse it instead of decoding the message again. Only the message is stored.
+type Consumed struct {
+	Message
+	Decoded interface{}
+}
+
+// storedMessage is the row of the message without the custom decoding.
+type storedMessage Message
+
+// UnmarshalRQL reads the headers of the rows stored before the header list: a json object of strings in the
+// headers field. Their keys are sorted, the order of the kafka headers is lost.
+func (message *Message) UnmarshalRQL(data interface{}) error {
+	var row struct {
+		storedMessage
+		LegacyHeaders []byte `rethinkdb:"headers"`
+	}
+
+	if err := encoding.Decode(&row, data); err != nil {
+		return err
+	}
+	*message = Message(row.storedMessage)
+
+	if len(message.Headers) > 0 || len(row.LegacyHeaders) == 0 {
+		return nil
+	}
+
+	var headers map[string]string
+	if err := json.Unmarshal(row.LegacyHeaders, &headers); err != nil {
+		log.Debugf("Message %s: legacy headers parse error: %s", message.ID, err.Error())
+		return nil
+	}
+
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	message.Headers = make([]Header, 0, len(keys))
+	for _, key := range keys {
+		message.Headers = append(message.Headers, Header{Key: key, Value: []byte(headers[key])})
+	}
+	return nil
 }
 
 func (message Message) Filter(filters Filters) bool {
@@ -34,11 +113,29 @@ func (message Message) Filter(filters Filters) bool {
 		return false
 	}
 
+	var payload interface{}
 	for _, filter := range filters.Filters {
 		if filter.FieldName == "" {
 			continue
 		}
 
+		if strings.HasPrefix(filter.FieldName, PayloadPathPrefix) {
+			if filters.Decoder == nil {
+				return false
+			}
+
+			if payload == nil {
+				payload = filters.Decoder.DecodePayload(message)
+			}
+
+			val, ok := PayloadPath(payload, strings.TrimPrefix(filter.FieldName, PayloadPathPrefix))
+			log.Tracef("Filter: compare payload path %s, message value: %v, filter value: %v", filter.FieldName, val, filter.FieldValue)
+			if !ok || !filter.Compare(val, filter.FieldValue) {
+				return false
+			}
+			continue
+		}
+
 		r := reflect.ValueOf(message)
 
 		if strings.Contains(messageFilterFields, strings.ToLower(filter.FieldName)) {
@@ -50,22 +147,107 @@ func (message Message) Filter(filters Filters) bool {
 			continue
 		}
 
-		var headers = map[string]string{}
-		_ = json.Unmarshal(message.Headers, &headers)
+		// the header filter passes when any of the headers with the key matches
+		var matched bool
+		for _, header := range message.Headers {
+			if header.Key != filter.FieldName {
+				continue
+			}
 
-		if val, ok := headers[filter.FieldName]; ok {
+			val, _ := header.RenderAs(filters.HeaderEncoding)
 			log.Tracef("Filter: compare header %s, message value: %s, filter value: %s", filter.FieldName, val, filter.FieldValue.(string))
-			if !filter.Compare(val, filter.FieldValue) {
-				return false
+			if filter.Compare(val, filter.FieldValue) {
+				matched = true
+				break
 			}
-			continue
 		}
-		return false
+
+		if !matched {
+			return false
+		}
 	}
 
 	return true
 }
 
+// PrimaryKey derives the message id from its position in the cluster, so a consumed again message replaces itself.
+func (message Message) PrimaryKey(cluster string) string {
+	return fmt.Sprintf("%s/%s/%d/%d", cluster, message.Topic, message.Partition, message.Offset)
+}
+
+// HeaderValue returns the value of the first header with the key.
+func (message Message) HeaderValue(key string) ([]byte, bool) {
+	for _, header := range message.Headers {
+		if header.Key == key {
+			return header.Value, true
+		}
+	}
+	return nil, false
+}
+
+// PayloadPath resolves the dot separated path in the decoded payload. Array items are addressed by index.
+func PayloadPath(payload interface{}, path string) (interface{}, bool) {
+	for _, key := range strings.Split(path, ".") {
+		switch node := payload.(type) {
+		case map[string]interface{}:
+			value, ok := node[key]
+			if !ok {
+				return nil, false
+			}
+			payload = value
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			payload = node[i]
+		default:
+			return nil, false
+		}
+	}
+
+	return payload, payload != nil
+}
+
+// Header keeps the kafka header as it was consumed: headers are ordered and keys may repeat.
+type Header struct {
+	Key   string `rethinkdb:"key"`
+	Value []byte `rethinkdb:"value"`
+}
+
+// Render returns the header value as text: utf-8 when the value is valid utf-8, base64 otherwise.
+func (header Header) Render() (value string, encoding string) {
+	return Render(header.Value)
+}
+
+// RenderAs returns the header value as text: utf-8 when the value is valid utf-8, the binary encoding otherwise.
+func (header Header) RenderAs(binary string) (value string, encoding string) {
+	return RenderAs(header.Value, binary)
+}
+
+// Render returns the bytes as text: utf-8 when the bytes are valid utf-8, base64 otherwise.
+func Render(value []byte) (string, string) {
+	return RenderAs(value, HeaderEncodingBase64)
+}
+
+// RenderAs returns the bytes as text: utf-8 when the bytes are valid utf-8, hex or base64 by the binary encoding
+// otherwise.
+func RenderAs(value []byte, binary string) (string, string) {
+	switch {
+	case utf8.Valid(value):
+		return string(value), HeaderEncodingUtf8
+	case binary == HeaderEncodingHex:
+		return hex.EncodeToString(value), HeaderEncodingHex
+	default:
+		return base64.StdEncoding.EncodeToString(value), HeaderEncodingBase64
+	}
+}
+
+type TopicEvent struct {
+	Topic   string
+	Deleted bool
+}
+
 type Changes struct {
 	OldValue Message `rethinkdb:"old_val"`
 	NewValue Message `rethinkdb:"new_val"`
@@ -73,19 +255,13 @@ type Changes struct {
 
 func New(msg kafka.Message) Message {
 	var (
-		dbHeaders []byte
-		offset    int64
-		err       error
+		offset int64
+		err    error
 	)
 
-	keyValue := map[string]string{}
+	headers := make([]Header, 0, len(msg.Headers))
 	for _, header := range msg.Headers {
-		keyValue[header.Key] = string(header.Value)
-	}
-
-	if dbHeaders, err = json.Marshal(keyValue); err != nil {
-		log.Warnf("Marshal header error: %s", err.Error())
-		dbHeaders = []byte(`{}`)
+		headers = append(headers, Header{Key: header.Key, Value: header.Value})
 	}
 
 	if offset, err = strconv.ParseInt(msg.TopicPartition.Offset.String(), 10, 64); err != nil {
@@ -95,7 +271,8 @@ func New(msg kafka.Message) Message {
 
 	return Message{
 		Topic:     *msg.TopicPartition.Topic,
-		Headers:   dbHeaders,
+		Key:       msg.Key,
+		Headers:   headers,
 		Offset:    int(offset),
 		Partition: int(msg.TopicPartition.Partition),
 		Timestamp: msg.Timestamp.Unix(),
@@ -109,14 +286,24 @@ type Comparator interface {
 	Compare(interface{}, interface{}) bool
 }
 
+// PayloadDecoder renders the message payload for the payload path filters.
+type PayloadDecoder interface {
+	DecodePayload(Message) interface{}
+}
+
 type Filters struct {
 	Topic   string
 	Filters []Filter
+	Decoder PayloadDecoder
+	// HeaderEncoding renders the binary header values to compare, the same as the socket shows them
+	HeaderEncoding string
 }
 
 type Filter struct {
 	FieldName  string
 	FieldValue interface{}
+	// Operator is one of the Operator constants, the number field filters with it are pushed down to the change feed
+	Operator   string
 	Comparator Comparator
 }
 
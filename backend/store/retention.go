@@ -0,0 +1,303 @@
+package store
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	rethink "gopkg.in/rethinkdb/rethinkdb-go.v6"
+)
+
+const (
+	retentionBatch = 1000
+	// bytesReconcileInterval is how often the running total of the stored bytes is summed again from the table
+	bytesReconcileInterval = time.Hour
+)
+
+type TopicUsage struct {
+	Topic    string    `rethinkdb:"group"`
+	Messages int64     `rethinkdb:"messages"`
+	Bytes    int64     `rethinkdb:"bytes"`
+	Oldest   time.Time `rethinkdb:"oldest"`
+	Newest   time.Time `rethinkdb:"newest"`
+}
+
+type Usage struct {
+	Topics   []TopicUsage
+	Messages int64
+	Bytes    int64
+}
+
+// serveRetention enforces the retention settings each retention interval: messages older than the max age,
+// the oldest messages of topics over the max messages and the oldest messages over the max total bytes are deleted.
+func (rethinkService *RethinkService) serveRetention() {
+	config := rethinkService.configure.Config
+	if config.RetentionMaxAge <= 0 && config.RetentionMaxMessages <= 0 && config.RetentionMaxBytes <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(config.RetentionInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-rethinkService.configure.GlobalContext.Done():
+				return
+
+			case <-ticker.C:
+				if err := rethinkService.enforceRetention(); err != nil {
+					log.Warnf("Retention error: %s", err.Error())
+				}
+			}
+		}
+	}()
+}
+
+func (rethinkService *RethinkService) enforceRetention() error {
+	var config = rethinkService.configure.Config
+
+	id, err := rethinkService.connect(true)
+	if err != nil {
+		return err
+	}
+	defer rethinkService.close(id)
+
+	if config.RetentionMaxAge > 0 {
+		expired := rethink.Table(tableName).
+			Between(rethink.MinVal, time.Now().Add(-config.RetentionMaxAge), rethink.BetweenOpts{Index: atIndex})
+
+		if err = rethinkService.deleteRange(id, "max age", expired); err != nil {
+			return err
+		}
+	}
+
+	if config.RetentionMaxMessages > 0 {
+		rethinkService.topicsMutex.Lock()
+		topics := append([]string(nil), rethinkService.topics...)
+		rethinkService.topicsMutex.Unlock()
+
+		for _, topic := range topics {
+			if err = rethinkService.enforceTopicMessages(id, topic, config.RetentionMaxMessages); err != nil {
+				return err
+			}
+		}
+	}
+
+	if config.RetentionMaxBytes > 0 {
+		return rethinkService.enforceBytes(id, config.RetentionMaxBytes)
+	}
+
+	return nil
+}
+
+func (rethinkService *RethinkService) enforceTopicMessages(id uuid.UUID, topic string, maxMessages int) error {
+	var count int
+
+	cursor, err := rethink.Table(tableName).GetAllByIndex(index, topic).Count().Run(rethinkService.getConnection(id))
+	if err != nil {
+		return err
+	}
+
+	if err = cursor.One(&count); err != nil {
+		return err
+	}
+
+	if count <= maxMessages {
+		return nil
+	}
+
+	oldest := rethink.Table(tableName).
+		Between([]interface{}{topic, rethink.MinVal}, []interface{}{topic, rethink.MaxVal}, rethink.BetweenOpts{Index: topicAtIndex}).
+		OrderBy(rethink.OrderByOpts{Index: topicAtIndex}).
+		Limit(count - maxMessages)
+
+	return rethinkService.deleteRange(id, "max messages of "+topic, oldest)
+}
+
+// deleteRange deletes the indexed range of the messages. With the max bytes retention the payload bytes of the
+// range are summed first to keep the running total.
+func (rethinkService *RethinkService) deleteRange(id uuid.UUID, reason string, term rethink.Term) error {
+	var size int64
+
+	if rethinkService.configure.Config.RetentionMaxBytes > 0 {
+		cursor, err := term.Sum("size").Run(rethinkService.getConnection(id))
+		if err != nil {
+			return err
+		}
+
+		if err = cursor.One(&size); err != nil {
+			return err
+		}
+	}
+
+	response, err := term.Delete().RunWrite(rethinkService.getConnection(id))
+	if err != nil {
+		return err
+	}
+
+	if response.Deleted > 0 {
+		rethinkService.changeStoredBytes(-size)
+	}
+	logDeleted(reason, response.Deleted)
+	return nil
+}
+
+// enforceBytes deletes the oldest messages until the total payload size fits into the max bytes. The total is kept
+// by the inserts and the deletes, the table is summed only when the total is unknown or every reconcile interval.
+func (rethinkService *RethinkService) enforceBytes(id uuid.UUID, maxBytes int64) error {
+	var (
+		total  = atomic.LoadInt64(&rethinkService.storedBytes)
+		cursor *rethink.Cursor
+		err    error
+	)
+
+	if total < 0 || time.Since(rethinkService.bytesSummedAt) >= bytesReconcileInterval {
+		if cursor, err = rethink.Table(tableName).Sum("size").Run(rethinkService.getConnection(id)); err != nil {
+			return err
+		}
+
+		if err = cursor.One(&total); err != nil {
+			return err
+		}
+
+		atomic.StoreInt64(&rethinkService.storedBytes, total)
+		rethinkService.bytesSummedAt = time.Now()
+	}
+
+	for total > maxBytes {
+		var sizes []int64
+
+		cursor, err = rethink.Table(tableName).
+			OrderBy(rethink.OrderByOpts{Index: atIndex}).
+			Limit(retentionBatch).Field("size").
+			Run(rethinkService.getConnection(id))
+		if err != nil {
+			return err
+		}
+
+		if err = cursor.All(&sizes); err != nil {
+			return err
+		}
+
+		var count, deleted, excess = 0, int64(0), total - maxBytes
+		for _, size := range sizes {
+			if excess <= 0 {
+				break
+			}
+			excess -= size
+			deleted += size
+			count++
+		}
+
+		response, err := rethink.Table(tableName).
+			OrderBy(rethink.OrderByOpts{Index: atIndex}).
+			Limit(count).
+			Delete().RunWrite(rethinkService.getConnection(id))
+		if err != nil {
+			return err
+		}
+
+		logDeleted("max bytes", response.Deleted)
+		if response.Deleted == 0 {
+			return nil
+		}
+
+		if response.Deleted != count {
+			// the deleted messages are not the summed ones
+			rethinkService.resetStoredBytes()
+			return nil
+		}
+		total -= deleted
+		rethinkService.changeStoredBytes(-deleted)
+	}
+
+	return nil
+}
+
+// addStoredBytes adds the payload bytes of the inserted rows to the running total. The rows which replaced stored
+// messages are not known, then the total is summed again.
+func (rethinkService *RethinkService) addStoredBytes(rows []Message, inserted int) {
+	if inserted != len(rows) {
+		rethinkService.resetStoredBytes()
+		return
+	}
+
+	var size int64
+	for _, row := range rows {
+		size += int64(row.Size)
+	}
+	rethinkService.changeStoredBytes(size)
+}
+
+// changeStoredBytes changes the running total of the stored bytes unless the total is unknown.
+func (rethinkService *RethinkService) changeStoredBytes(delta int64) {
+	for {
+		current := atomic.LoadInt64(&rethinkService.storedBytes)
+		if current < 0 || atomic.CompareAndSwapInt64(&rethinkService.storedBytes, current, current+delta) {
+			return
+		}
+	}
+}
+
+// resetStoredBytes makes the running total unknown, the next max bytes retention sums the table.
+func (rethinkService *RethinkService) resetStoredBytes() {
+	atomic.StoreInt64(&rethinkService.storedBytes, -1)
+}
+
+// Usage returns the stored messages and payload bytes per topic.
+func (rethinkService *RethinkService) Usage() (usage Usage, err error) {
+	var (
+		id     uuid.UUID
+		cursor *rethink.Cursor
+	)
+
+	if id, err = rethinkService.connect(true); err != nil {
+		return usage, err
+	}
+	defer rethinkService.close(id)
+
+	cursor, err = rethink.Table(tableName).GroupByIndex(index).
+		Map(func(row rethink.Term) interface{} {
+			return map[string]interface{}{
+				"messages": 1,
+				"bytes":    row.Field("size"),
+				"oldest":   row.Field("at"),
+				"newest":   row.Field("at"),
+			}
+		}).
+		Reduce(func(left, right rethink.Term) interface{} {
+			return map[string]interface{}{
+				"messages": left.Field("messages").Add(right.Field("messages")),
+				"bytes":    left.Field("bytes").Add(right.Field("bytes")),
+				"oldest":   rethink.Branch(left.Field("oldest").Lt(right.Field("oldest")), left.Field("oldest"), right.Field("oldest")),
+				"newest":   rethink.Branch(left.Field("newest").Gt(right.Field("newest")), left.Field("newest"), right.Field("newest")),
+			}
+		}).
+		Ungroup().
+		Map(func(row rethink.Term) interface{} {
+			return row.Field("reduction").Merge(map[string]interface{}{"group": row.Field("group")})
+		}).
+		Run(rethinkService.getConnection(id))
+	if err != nil {
+		return usage, err
+	}
+
+	if err = cursor.All(&usage.Topics); err != nil {
+		return usage, err
+	}
+
+	for _, topic := range usage.Topics {
+		usage.Messages += topic.Messages
+		usage.Bytes += topic.Bytes
+	}
+
+	return usage, nil
+}
+
+func logDeleted(reason string, deleted int) {
+	if deleted > 0 {
+		log.Infof("Retention: deleted %d messages by %s", deleted, reason)
+	}
+}
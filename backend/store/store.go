@@ -2,6 +2,7 @@ package store
 
 import (
 	"context"
+	"errors"
 	"strings"
 	"sync"
 	"time"
@@ -11,39 +12,69 @@ import (
 	rethink "gopkg.in/rethinkdb/rethinkdb-go.v6"
 
 	"backend/config"
+	"backend/health"
+	"backend/ingest"
+	"backend/metrics"
 )
 
 const (
 	dbName       = "topics"
 	tableName    = "message"
 	index        = "topic"
+	atIndex      = "at"
+	topicAtIndex = "topic_at"
 	NewTopicChan = "topicChan"
 	SkipTopics   = "__consumer_offsets"
+
+	correlationIndex = "correlation"
+
+	maxInsertRetry    = 30 * time.Second
+	maxReconnectDelay = 30 * time.Second
+	startTimeout      = 10 * time.Second
+	topicEventsBuffer = 64
 )
 
 type Service interface {
 	Serve()
-	Stop()
+	Stop(ctx context.Context)
 }
 
 type RethinkService struct {
-	configure      *config.Configure `di.inject:"appConfigure"`
+	configure      *config.Configure     `di.inject:"appConfigure"`
+	healthSvc      *health.Health        `di.inject:"health"`
+	ingestSvc      *ingest.Metrics       `di.inject:"ingestMetrics"`
+	storedOffsets  *ingest.StoredOffsets `di.inject:"storedOffsets"`
 	connectionPool map[uuid.UUID]*rethink.Session
 	topics         []string
-	newTopicChan   chan string
 	mutex          sync.RWMutex
+	topicsMutex    sync.Mutex
+	// topicSubscribers are the topic event channels of the sockets, every event is sent to all of them
+	topicSubscribers      map[chan TopicEvent]struct{}
+	topicSubscribersMutex sync.Mutex
+	feeds                 feeds
+	listeners             []Listener
+	enrichers             []Enricher
+	listenersMutex        sync.RWMutex
+	stop                  chan struct{}
+	done                  chan struct{}
+	// storedBytes is the running total of the stored payload bytes for the max bytes retention, -1 when unknown
+	storedBytes   int64
+	bytesSummedAt time.Time
 }
 
-func (rethinkService *RethinkService) Topics(socketContext context.Context, startChan <-chan interface{}) <-chan Message {
+func (rethinkService *RethinkService) Topics(socketContext context.Context, startChan <-chan interface{}) <-chan TopicEvent {
 	var (
 		cursor  *rethink.Cursor
 		err     error
-		msgChan = make(chan Message, 1)
+		msgChan = make(chan TopicEvent, 1)
 		topic   string
+		event   TopicEvent
+		events  = rethinkService.subscribeTopics()
 	)
 
 	go func() {
 		defer close(msgChan)
+		defer rethinkService.unsubscribeTopics(events)
 
 		id, _ := rethinkService.connect(true)
 		defer rethinkService.close(id)
@@ -52,6 +83,16 @@ func (rethinkService *RethinkService) Topics(socketContext context.Context, star
 			Index: index,
 		})
 
+		// send stops with the socket, the socket which is closed on shutdown does not read its events
+		send := func(event TopicEvent) bool {
+			select {
+			case msgChan <- event:
+				return true
+			case <-socketContext.Done():
+				return false
+			}
+		}
+
 		for {
 			select {
 			case <-socketContext.Done():
@@ -62,9 +103,11 @@ func (rethinkService *RethinkService) Topics(socketContext context.Context, star
 				log.Info("Close rethinkDb connection for read topics. Application context close")
 				return
 
-			case topic = <-rethinkService.newTopicChan:
-				log.Tracef("Get new topic: %s", topic)
-				msgChan <- Message{Topic: topic}
+			case event = <-events:
+				log.Tracef("Get topic event: %v", event)
+				if !send(event) {
+					return
+				}
 
 			case <-startChan:
 				if cursor, err = termTopics.Run(rethinkService.getConnection(id)); err != nil {
@@ -72,7 +115,10 @@ func (rethinkService *RethinkService) Topics(socketContext context.Context, star
 				}
 
 				for cursor.Next(&topic) {
-					msgChan <- Message{Topic: topic}
+					if !send(TopicEvent{Topic: topic}) {
+						_ = cursor.Close()
+						return
+					}
 				}
 			}
 		}
@@ -81,20 +127,27 @@ func (rethinkService *RethinkService) Topics(socketContext context.Context, star
 	return msgChan
 }
 
-func (rethinkService *RethinkService) Messages(socketContext context.Context, filterChan <-chan Filters) <-chan Message {
-	msgChan := make(chan Message, 1)
+func (rethinkService *RethinkService) Messages(socketContext context.Context, filterChan <-chan Filters) <-chan FeedMessage {
+	msgChan := make(chan FeedMessage, 1)
 
 	go func() {
 		var (
 			filter      Filters
-			changesChan = make(chan Message)
+			feedKey     string
+			changesChan chan FeedMessage
+			// dropped counts the changes dropped before the filtered out messages
+			dropped int64
 		)
 		defer close(msgChan)
 
 		id, _ := rethinkService.connect(true)
 		defer rethinkService.close(id)
 
-		rethinkService.listenChanges(socketContext, id, changesChan)
+		defer func() {
+			if changesChan != nil {
+				rethinkService.unsubscribe(feedKey, changesChan)
+			}
+		}()
 
 		for {
 			select {
@@ -107,11 +160,22 @@ func (rethinkService *RethinkService) Messages(socketContext context.Context, fi
 				return
 
 			case filter = <-filterChan:
+				if changesChan != nil {
+					rethinkService.unsubscribe(feedKey, changesChan)
+				}
+				feedKey, changesChan = rethinkService.subscribe(filter)
+
 				rethinkService.getLastMessages(id, msgChan, filter, 20)
 
 			case msg := <-changesChan:
+				dropped += msg.Dropped
 				if msg.Filter(filter) {
-					msgChan <- msg
+					msg.Dropped, dropped = dropped, 0
+					select {
+					case msgChan <- msg:
+					case <-socketContext.Done():
+						return
+					}
 				}
 			}
 		}
@@ -120,59 +184,27 @@ func (rethinkService *RethinkService) Messages(socketContext context.Context, fi
 	return msgChan
 }
 
-func (rethinkService *RethinkService) listenChanges(socketContext context.Context, id uuid.UUID, msgChan chan Message) {
+func (rethinkService *RethinkService) Serve() {
+	rethinkService.connectionPool = make(map[uuid.UUID]*rethink.Session)
+	rethinkService.topicSubscribers = make(map[chan TopicEvent]struct{})
+	rethinkService.stop = make(chan struct{})
+	rethinkService.done = make(chan struct{})
+	rethinkService.resetStoredBytes()
+	rethinkService.ingestSvc.SetQueue(rethinkService.configure.ServeWriteChannel())
+	metrics.RegisterIngest(rethinkService.ingestSvc)
+
+	ready := make(chan struct{})
 	go func() {
-		var (
-			changes Changes
-			cursor  *rethink.Cursor
-		)
-		defer cursor.Close()
-
-		for {
-			select {
-			case <-socketContext.Done():
-				log.Info("Close rethinkDb connection to listen changes. Socket context close")
-				return
-
-			case <-rethinkService.configure.GlobalContext.Done():
-				log.Info("Close rethinkDb connection to listen changes. Application context close")
-				return
+		defer close(rethinkService.done)
 
-			default:
-				cursor, err := rethink.Table(tableName).Changes().Run(rethinkService.getConnection(id))
-				if err != nil {
-					log.Errorf("RethinkDb get changes error: %s", err.Error())
-				}
-
-				if cursor.Next(&changes) {
-					msgChan <- changes.NewValue
-				}
-			}
-		}
-	}()
-}
-
-func (rethinkService *RethinkService) Serve() {
-	var (
-		err        error
-		retryCount = 10
-	)
-	for retryCount > 0 {
-		if err = rethinkService.InitializeContext(); err != nil {
-			retryCount--
-			time.Sleep(1 * time.Second)
-			continue
+		id, ok := rethinkService.initialize()
+		if !ok {
+			return
 		}
-		break
-	}
-
-	if retryCount == 0 && err != nil {
-		log.Fatalf("Db error: %s", err.Error())
-	}
-
-	go func() {
-		id, _ := rethinkService.connect(true)
 		defer rethinkService.close(id)
+		close(ready)
+
+		rethinkService.serveRetention()
 
 		// init start topics
 		var topic string
@@ -184,31 +216,174 @@ func (rethinkService *RethinkService) Serve() {
 			if strings.Contains(topic, SkipTopics) {
 				continue
 			}
+			rethinkService.topicsMutex.Lock()
 			rethinkService.topics = append(rethinkService.topics, topic)
+			rethinkService.topicsMutex.Unlock()
 		}
 
-		for {
+		rethinkService.ingest(id)
+	}()
+
+	// the services which read the store on start wait for the db for a while, then the store goes on connecting in
+	// the background and reports the db is down
+	select {
+	case <-ready:
+	case <-time.After(startTimeout):
+		log.Warnf("Db is not available in %s, continue to connect in the background", startTimeout)
+	}
+}
+
+// initialize creates the db, the table and the indexes and opens the ingest connection. It retries with the backoff
+// and returns false when the application stops first.
+func (rethinkService *RethinkService) initialize() (uuid.UUID, bool) {
+	for retry := time.Second; ; retry = minDuration(2*retry, maxReconnectDelay) {
+		err := rethinkService.InitializeContext()
+		if err == nil {
+			var id uuid.UUID
+			if id, err = rethinkService.connect(true); err == nil {
+				rethinkService.healthSvc.Up(health.Store)
+				return id, true
+			}
+		}
+
+		rethinkService.healthSvc.Down(health.Store, err)
+		log.Errorf("Db error: %s. Retry in %s", err.Error(), retry)
+
+		select {
+		case <-rethinkService.configure.GlobalContext.Done():
+			return uuid.UUID{}, false
+		case <-rethinkService.stop:
+			return uuid.UUID{}, false
+		case <-time.After(retry):
+		}
+	}
+}
+
+// ingest collects consumed messages into batches which are inserted when the batch size is reached or the batch
+// timeout expires, whichever comes first.
+func (rethinkService *RethinkService) ingest(id uuid.UUID) {
+	var (
+		settings   = rethinkService.configure.Config
+		batch      = make([]Consumed, 0, settings.IngestBatchSize)
+		rows       = make([]Message, 0, settings.IngestBatchSize)
+		flushTimer = time.NewTicker(settings.IngestBatchTimeout)
+		rateTimer  = time.NewTicker(time.Second)
+	)
+	defer flushTimer.Stop()
+	defer rateTimer.Stop()
+
+	// flush retries the insert until it succeeds, the consumer commits offsets only of the stored messages
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		// only the messages are stored, the decoded payloads are for the listeners
+		rows = rows[:0]
+		for _, message := range batch {
+			rows = append(rows, message.Message)
+		}
+
+		var failed bool
+		for retry := time.Second; ; retry = minDuration(2*retry, maxInsertRetry) {
+			start := time.Now()
+			response, err := rethink.Table(tableName).Insert(rows, rethink.InsertOpts{Conflict: "replace"}).RunWrite(rethinkService.getConnection(id))
+			metrics.InsertDuration.Observe(time.Since(start).Seconds())
+			if err == nil {
+				rethinkService.addStoredBytes(rows, response.Inserted)
+				break
+			}
+
+			log.Warnf("Insert %d messages error: %s. Retry in %s", len(batch), err.Error(), retry)
+			metrics.InsertErrors.Inc()
+			rethinkService.healthSvc.Down(health.Store, err)
+			rethinkService.reconnect(id)
+			if !failed {
+				// the batch is retried until it is stored, its messages are counted as failed once
+				failed = true
+				rethinkService.ingestSvc.AddFailed(len(batch) - response.Inserted - response.Replaced - response.Unchanged)
+			}
+
 			select {
 			case <-rethinkService.configure.GlobalContext.Done():
 				return
+			case <-time.After(retry):
+			}
+		}
 
-			case msg, ok := <-rethinkService.configure.ServeReadChannel():
-				if !ok {
+		for _, message := range batch {
+			rethinkService.storedOffsets.Mark(message.Topic, int32(message.Partition), int64(message.Offset))
+			metrics.StoredMessages.WithLabelValues(message.Topic).Inc()
+		}
+
+		rethinkService.healthSvc.Up(health.Store)
+		rethinkService.ingestSvc.AddBatch(len(batch), 0)
+		rethinkService.notifyStored(batch)
+		batch = batch[:0]
+	}
+
+	// add enriches the consumed message and appends it to the batch
+	add := func(msg interface{}) {
+		message := Consumed{Message: msg.(Message)}
+		message.ID = message.PrimaryKey(rethinkService.configure.ClusterName())
+		rethinkService.enrich(&message)
+		rethinkService.appendTopic(message.Topic)
+
+		if batch = append(batch, message); len(batch) >= settings.IngestBatchSize {
+			flush()
+		}
+	}
+
+	for {
+		select {
+		case <-rethinkService.configure.GlobalContext.Done():
+			flush()
+			return
+
+		case <-rethinkService.stop:
+			// the consumer is stopped already, the queued messages are the last ones
+			for {
+				select {
+				case msg := <-rethinkService.configure.ServeReadChannel():
+					add(msg)
+				default:
+					flush()
 					return
 				}
+			}
 
-				rethinkService.appendTopic(msg.(Message).Topic)
+		case <-rateTimer.C:
+			rethinkService.ingestSvc.UpdateRate(time.Second)
 
-				err := rethink.Table(tableName).Insert(msg.(Message)).Exec(rethinkService.getConnection(id))
-				if err != nil {
-					log.Warnf("Insert message error: %s", err.Error())
-				}
+		case <-flushTimer.C:
+			flush()
+
+		case msg, ok := <-rethinkService.configure.ServeReadChannel():
+			if !ok {
+				flush()
+				return
 			}
+			add(msg)
 		}
-	}()
+	}
+}
+
+func minDuration(left, right time.Duration) time.Duration {
+	if left < right {
+		return left
+	}
+	return right
 }
 
-func (rethinkService *RethinkService) Stop() {
+// Stop inserts the queued messages and waits for the pending batch.
+func (rethinkService *RethinkService) Stop(ctx context.Context) {
+	close(rethinkService.stop)
+
+	select {
+	case <-rethinkService.done:
+	case <-ctx.Done():
+		log.Warnf("Db: %d consumed messages are not stored before the shutdown", rethinkService.ingestSvc.InFlight())
+	}
 }
 
 func (rethinkService *RethinkService) InitializeContext() error {
@@ -216,25 +391,21 @@ func (rethinkService *RethinkService) InitializeContext() error {
 		err error
 		id  uuid.UUID
 	)
-	rethinkService.mutex = sync.RWMutex{}
 	// Create DB
-	rethinkService.connectionPool = make(map[uuid.UUID]*rethink.Session)
-	rethinkService.newTopicChan = make(chan string)
-
 	if id, err = rethinkService.connect(false); err != nil {
 		return err
 	}
+	defer rethinkService.close(id)
 
 	if err = rethinkService.executeCreateIfAbsent(rethink.DBList().Contains(dbName), rethink.DBCreate(dbName), id); err != nil {
 		return err
 	}
 
-	rethinkService.close(id)
-
 	// Create Table And Index
 	if id, err = rethinkService.connect(true); err != nil {
 		return err
 	}
+	defer rethinkService.close(id)
 
 	if err = rethinkService.executeCreateIfAbsent(rethink.TableList().Contains(tableName), rethink.TableCreate(tableName), id); err != nil {
 		return err
@@ -244,8 +415,22 @@ func (rethinkService *RethinkService) InitializeContext() error {
 		return err
 	}
 
+	if err = rethinkService.executeCreateIfAbsent(rethink.Table(tableName).IndexList().Contains(atIndex), rethink.Table(tableName).IndexCreate(atIndex), id); err != nil {
+		return err
+	}
+
+	if err = rethinkService.executeCreateIfAbsent(rethink.Table(tableName).IndexList().Contains(correlationIndex), rethink.Table(tableName).IndexCreate(correlationIndex), id); err != nil {
+		return err
+	}
+
+	topicAtTerm := rethink.Table(tableName).IndexCreateFunc(topicAtIndex, func(row rethink.Term) interface{} {
+		return []interface{}{row.Field("topic"), row.Field("at")}
+	})
+	if err = rethinkService.executeCreateIfAbsent(rethink.Table(tableName).IndexList().Contains(topicAtIndex), topicAtTerm, id); err != nil {
+		return err
+	}
+
 	_ = rethink.Table(tableName).IndexWait().Exec(rethinkService.getConnection(id))
-	rethinkService.close(id)
 
 	return nil
 }
@@ -272,12 +457,27 @@ func (rethinkService *RethinkService) connect(isDbCreated bool) (uuid.UUID, erro
 }
 
 func (rethinkService *RethinkService) close(id uuid.UUID) {
-	rethinkService.getConnection(id).Close()
+	// the connection is absent when the db was not available
+	if session := rethinkService.getConnection(id); session != nil {
+		session.Close()
+	}
 	rethinkService.mutex.Lock()
 	delete(rethinkService.connectionPool, id)
 	rethinkService.mutex.Unlock()
 }
 
+// reconnect restores the session of the connection after the db was unavailable.
+func (rethinkService *RethinkService) reconnect(id uuid.UUID) {
+	session := rethinkService.getConnection(id)
+	if session == nil || session.IsConnected() {
+		return
+	}
+
+	if err := session.Reconnect(); err != nil {
+		log.Warnf("Db reconnect error: %s", err.Error())
+	}
+}
+
 func (rethinkService *RethinkService) executeCreateIfAbsent(listTerm rethink.Term, createTerm rethink.Term, id uuid.UUID) error {
 	var (
 		isContains bool
@@ -299,7 +499,7 @@ func (rethinkService *RethinkService) executeCreateIfAbsent(listTerm rethink.Ter
 	return nil
 }
 
-func (rethinkService *RethinkService) getLastMessages(id uuid.UUID, msgChan chan Message, filters Filters, count int) {
+func (rethinkService *RethinkService) getLastMessages(id uuid.UUID, msgChan chan FeedMessage, filters Filters, count int) {
 	var filterTerm = rethink.Table(tableName)
 
 	if filters.Topic != "" {
@@ -320,20 +520,82 @@ func (rethinkService *RethinkService) getLastMessages(id uuid.UUID, msgChan chan
 
 	for _, msg := range msgs {
 		if msg.Filter(filters) {
-			msgChan <- msg
+			msgChan <- FeedMessage{Message: msg, History: true}
 		}
 	}
 }
 
 func (rethinkService *RethinkService) appendTopic(topic string) {
+	rethinkService.topicsMutex.Lock()
 	for _, v := range rethinkService.topics {
 		if v == topic || strings.Contains(v, SkipTopics) {
+			rethinkService.topicsMutex.Unlock()
 			return
 		}
 	}
 	rethinkService.topics = append(rethinkService.topics, topic)
+	rethinkService.topicsMutex.Unlock()
+
 	log.Tracef("Send new topic: %s", topic)
-	rethinkService.newTopicChan <- topic
+	rethinkService.publishTopic(TopicEvent{Topic: topic})
+}
+
+// PurgeTopic deletes stored messages of the topic and notifies sockets that the topic is gone.
+func (rethinkService *RethinkService) PurgeTopic(topic string) error {
+	id, err := rethinkService.connect(true)
+	if err != nil {
+		return err
+	}
+	defer rethinkService.close(id)
+
+	if err = rethink.Table(tableName).GetAllByIndex(index, topic).Delete().Exec(rethinkService.getConnection(id)); err != nil {
+		return err
+	}
+	rethinkService.resetStoredBytes()
+
+	rethinkService.topicsMutex.Lock()
+	for i, v := range rethinkService.topics {
+		if v == topic {
+			rethinkService.topics = append(rethinkService.topics[:i], rethinkService.topics[i+1:]...)
+			break
+		}
+	}
+	rethinkService.topicsMutex.Unlock()
+
+	log.Infof("Purge topic: %s", topic)
+	rethinkService.publishTopic(TopicEvent{Topic: topic, Deleted: true})
+
+	return nil
+}
+
+func (rethinkService *RethinkService) subscribeTopics() chan TopicEvent {
+	events := make(chan TopicEvent, topicEventsBuffer)
+
+	rethinkService.topicSubscribersMutex.Lock()
+	rethinkService.topicSubscribers[events] = struct{}{}
+	rethinkService.topicSubscribersMutex.Unlock()
+	return events
+}
+
+func (rethinkService *RethinkService) unsubscribeTopics(events chan TopicEvent) {
+	rethinkService.topicSubscribersMutex.Lock()
+	delete(rethinkService.topicSubscribers, events)
+	rethinkService.topicSubscribersMutex.Unlock()
+}
+
+// publishTopic sends the event to every socket without blocking, the event is dropped for the socket which is not
+// reading its events.
+func (rethinkService *RethinkService) publishTopic(event TopicEvent) {
+	rethinkService.topicSubscribersMutex.Lock()
+	defer rethinkService.topicSubscribersMutex.Unlock()
+
+	for events := range rethinkService.topicSubscribers {
+		select {
+		case events <- event:
+		default:
+			log.Warnf("Drop topic event of a slow socket: %v", event)
+		}
+	}
 }
 
 func (rethinkService *RethinkService) getConnection(id uuid.UUID) *rethink.Session {
@@ -350,3 +612,118 @@ func (rethinkService *RethinkService) createConnection(session *rethink.Session)
 	rethinkService.mutex.Unlock()
 	return id
 }
+
+// LastOffsets returns the last stored offset for each partition of the topic.
+func (rethinkService *RethinkService) LastOffsets(topic string) (map[int]int, error) {
+	var (
+		id      uuid.UUID
+		cursor  *rethink.Cursor
+		err     error
+		grouped []struct {
+			Partition int `rethinkdb:"group"`
+			Offset    int `rethinkdb:"reduction"`
+		}
+	)
+
+	if id, err = rethinkService.connect(true); err != nil {
+		return nil, err
+	}
+	defer rethinkService.close(id)
+
+	cursor, err = rethink.Table(tableName).GetAllByIndex(index, topic).
+		Group("partition").Max("offset").Field("offset").Ungroup().
+		Run(rethinkService.getConnection(id))
+	if err != nil {
+		return nil, err
+	}
+
+	if err = cursor.All(&grouped); err != nil {
+		return nil, err
+	}
+
+	offsets := make(map[int]int, len(grouped))
+	for _, group := range grouped {
+		offsets[group.Partition] = group.Offset
+	}
+
+	return offsets, nil
+}
+
+// Message returns the stored message of the topic partition at the offset. The message is read by its primary key,
+// the rows stored before the ids were derived from the position are looked up in the topic.
+func (rethinkService *RethinkService) Message(topic string, partition int, offset int) (message Message, err error) {
+	var (
+		id     uuid.UUID
+		cursor *rethink.Cursor
+		key    = Message{Topic: topic, Partition: partition, Offset: offset}.PrimaryKey(rethinkService.configure.ClusterName())
+	)
+
+	if id, err = rethinkService.connect(true); err != nil {
+		return message, err
+	}
+	defer rethinkService.close(id)
+
+	if cursor, err = rethink.Table(tableName).Get(key).Run(rethinkService.getConnection(id)); err != nil {
+		return message, err
+	}
+
+	if err = cursor.One(&message); !errors.Is(err, rethink.ErrEmptyResult) {
+		return message, err
+	}
+
+	cursor, err = rethink.Table(tableName).GetAllByIndex(index, topic).
+		Filter(rethink.Row.Field("partition").Eq(partition).And(rethink.Row.Field("offset").Eq(offset))).
+		Limit(1).Run(rethinkService.getConnection(id))
+	if err != nil {
+		return message, err
+	}
+
+	err = cursor.One(&message)
+	return message, err
+}
+
+// Export calls the function for every stored message which passes the filters, ordered by time. Messages are
+// read with a cursor, so the export doesn't keep them in memory. Empty filters pass all messages.
+func (rethinkService *RethinkService) Export(ctx context.Context, filters Filters, fn func(Message) error) error {
+	var (
+		id      uuid.UUID
+		cursor  *rethink.Cursor
+		message Message
+		term    rethink.Term
+		err     error
+	)
+
+	if id, err = rethinkService.connect(true); err != nil {
+		return err
+	}
+	defer rethinkService.close(id)
+
+	if filters.Topic != "" {
+		term = rethink.Table(tableName).
+			Between([]interface{}{filters.Topic, rethink.MinVal}, []interface{}{filters.Topic, rethink.MaxVal}, rethink.BetweenOpts{Index: topicAtIndex}).
+			OrderBy(rethink.OrderByOpts{Index: topicAtIndex})
+	} else {
+		term = rethink.Table(tableName).OrderBy(rethink.OrderByOpts{Index: atIndex})
+	}
+
+	if cursor, err = term.Run(rethinkService.getConnection(id)); err != nil {
+		return err
+	}
+	defer cursor.Close()
+
+	all := filters.Topic == "" && len(filters.Filters) == 0
+	for cursor.Next(&message) {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if all || message.Filter(filters) {
+			if err = fn(message); err != nil {
+				return err
+			}
+		}
+		message = Message{}
+	}
+
+	return cursor.Err()
+}
@@ -0,0 +1,208 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"backend/config"
+	"backend/decoder"
+	"backend/store"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrTraceDisabled       = errors.New("tracing is disabled, set the trace header or the trace payload path")
+	ErrCorrelationRequired = errors.New("correlation id is required")
+)
+
+type Step struct {
+	Topic     string
+	Partition int
+	Offset    int
+	At        time.Time
+	// Gap is the time since the previous step
+	Gap time.Duration
+	// Expected is the index in the expected sequence, -1 for a topic out of the sequence
+	Expected   int
+	OutOfOrder bool
+}
+
+type Trace struct {
+	Correlation string
+	Steps       []Step
+	Missing     []string
+	Duration    time.Duration
+	// Since is the start of the tracing in this process, older messages are traced only when they were stored
+	// with the tracing configured
+	Since time.Time
+	// Undecoded is the number of the payloads not read for the correlation id while their schema was looked up
+	Undecoded int64
+}
+
+// Tracer finds the messages of a saga by the correlation id. The id is read at ingest from the trace header or the
+// trace payload path and is stored with the message, so only messages stored after the tracing is configured are
+// traced. The ingest does not wait for the schema registry: a payload with a schema which is not cached yet has no
+// correlation id.
+type Tracer struct {
+	configure  *config.Configure     `di.inject:"appConfigure"`
+	storeSvc   *store.RethinkService `di.inject:"storeService"`
+	decoderSvc *decoder.Decoder      `di.inject:"decoderService"`
+	sequence   []*regexp.Regexp
+	// topics are the topics which payloads are decoded for the correlation id
+	topics    []*regexp.Regexp
+	since     time.Time
+	undecoded int64
+}
+
+func (tracer *Tracer) Serve() {
+	var config = tracer.configure.Config
+	if !tracer.enabled() {
+		return
+	}
+
+	tracer.sequence = compilePatterns("Trace sequence", config.TraceSequence)
+
+	// without the trace topics the payloads of the sequence topics are decoded
+	if tracer.topics = compilePatterns("Trace topics", config.TraceTopics); len(tracer.topics) == 0 {
+		tracer.topics = tracer.sequence
+	}
+
+	tracer.since = time.Now()
+	tracer.storeSvc.AddEnricher(tracer)
+}
+
+func compilePatterns(name string, patterns string) (result []*regexp.Regexp) {
+	for _, pattern := range strings.Split(patterns, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern == "" {
+			continue
+		}
+
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			log.Warnf("%s: invalid topic pattern '%s': %s", name, pattern, err.Error())
+			continue
+		}
+		result = append(result, compiled)
+	}
+	return result
+}
+
+func (tracer *Tracer) Stop(ctx context.Context) {
+}
+
+// Enrich sets the correlation id of the consumed message.
+func (tracer *Tracer) Enrich(message *store.Consumed) {
+	var config = tracer.configure.Config
+
+	if config.TraceHeader != "" {
+		if value, ok := message.HeaderValue(config.TraceHeader); ok && len(value) > 0 {
+			message.Correlation = string(value)
+			return
+		}
+	}
+
+	if config.TracePayloadPath != "" && tracer.traced(message.Topic) {
+		payload, ok := tracer.decoderSvc.DecodeCached(message)
+		if !ok {
+			atomic.AddInt64(&tracer.undecoded, 1)
+			return
+		}
+
+		if value, ok := store.PayloadPath(payload.Value, config.TracePayloadPath); ok {
+			message.Correlation = fmt.Sprint(value)
+		}
+	}
+}
+
+// traced reports whether the payloads of the topic are decoded for the correlation id. Without the trace topics and
+// the sequence every topic is traced.
+func (tracer *Tracer) traced(topic string) bool {
+	if len(tracer.topics) == 0 {
+		return true
+	}
+
+	for _, pattern := range tracer.topics {
+		if pattern.MatchString(topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// Trace returns the messages with the correlation id in time order with the gaps between them and the missing
+// steps of the expected sequence.
+func (tracer *Tracer) Trace(correlation string) (trace Trace, err error) {
+	if !tracer.enabled() {
+		return trace, ErrTraceDisabled
+	}
+
+	if correlation == "" {
+		return trace, ErrCorrelationRequired
+	}
+
+	messages, err := tracer.storeSvc.Correlated(correlation)
+	if err != nil {
+		return trace, err
+	}
+
+	var (
+		found    = make([]bool, len(tracer.sequence))
+		expected = -1
+	)
+
+	trace.Correlation, trace.Since, trace.Undecoded = correlation, tracer.since, atomic.LoadInt64(&tracer.undecoded)
+	for i, message := range messages {
+		step := Step{
+			Topic:     message.Topic,
+			Partition: message.Partition,
+			Offset:    message.Offset,
+			At:        message.At,
+			Expected:  tracer.expectedIndex(message.Topic),
+		}
+
+		if i > 0 {
+			step.Gap = message.At.Sub(messages[i-1].At)
+		}
+
+		if step.Expected >= 0 {
+			found[step.Expected] = true
+			step.OutOfOrder = step.Expected < expected
+			if step.Expected > expected {
+				expected = step.Expected
+			}
+		}
+
+		trace.Steps = append(trace.Steps, step)
+	}
+
+	for i, pattern := range tracer.sequence {
+		if !found[i] {
+			trace.Missing = append(trace.Missing, pattern.String())
+		}
+	}
+
+	if len(messages) > 1 {
+		trace.Duration = messages[len(messages)-1].At.Sub(messages[0].At)
+	}
+
+	return trace, nil
+}
+
+func (tracer *Tracer) expectedIndex(topic string) int {
+	for i, pattern := range tracer.sequence {
+		if pattern.MatchString(topic) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (tracer *Tracer) enabled() bool {
+	return tracer.configure.Config.TraceHeader != "" || tracer.configure.Config.TracePayloadPath != ""
+}
@@ -1,73 +1,429 @@
 package ws
 
 import (
-	"encoding/json"
+	"encoding/base64"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
+	"backend/decoder"
+	"backend/health"
+	"backend/ingest"
+	"backend/provider"
+	"backend/search"
+	"backend/stats"
 	"backend/store"
+	"backend/trace"
 )
 
-var messageFilterFields = map[CastType]string{
-	CastTypeStr: "topic;at",
-	CastTypeInt: "offset;partition;timestamp;size",
-}
+// traceNote tells the client which messages the trace does not find.
+const traceNote = "Only the messages stored while the tracing is configured have the correlation id, " +
+	"the undecoded payloads are not traced"
 
-func ConvertToWsMessage(message store.Message) Messages {
-	var headers = map[string]string{}
-	_ = json.Unmarshal(message.Headers, &headers)
+// searchNote tells the client which messages the search does not find.
+const searchNote = "Only the messages stored between indexedFrom and indexedTo are searched, " +
+	"the older messages and the skipped batches are not found"
 
-	var body = map[string]interface{}{}
-	_ = json.Unmarshal(message.Message, &body)
+func ConvertToWsMessage(message store.Message, payload decoder.Payload, binaryEncoding string, raw bool) Messages {
+	var headers = make([]Header, 0, len(message.Headers))
+	for _, header := range message.Headers {
+		value, encoding := header.RenderAs(binaryEncoding)
+		headers = append(headers, Header{Key: header.Key, Value: value, Encoding: encoding})
+	}
 
-	return Messages{
+	result := Messages{
 		Message: Message{
-			Topic:       message.Topic,
-			Headers:     headers,
-			Offset:      strconv.FormatInt(int64(message.Offset), 10),
-			Partition:   string(rune(message.Partition)),
-			Timestamp:   strconv.FormatInt(message.Timestamp, 10),
-			At:          message.At.Format(time.RFC3339),
-			PayloadSize: strconv.Itoa(message.Size),
-			Payload:     body,
+			Topic:           message.Topic,
+			Headers:         headers,
+			Offset:          strconv.FormatInt(int64(message.Offset), 10),
+			Partition:       string(rune(message.Partition)),
+			Timestamp:       strconv.FormatInt(message.Timestamp, 10),
+			At:              message.At.Format(time.RFC3339),
+			PayloadSize:     strconv.Itoa(message.Size),
+			Payload:         payload.Value,
+			PayloadEncoding: payload.Encoding,
+			SchemaID:        payload.SchemaID,
+			Subject:         payload.Subject,
+			DecodeError:     payload.Error,
 		},
 	}
+
+	if raw {
+		result.Message.Raw = base64.StdEncoding.EncodeToString(message.Message)
+	}
+	return result
 }
 
-func ConvertToWsTopic(message store.Message) Topic {
+func ConvertToWsTopic(event store.TopicEvent) Topic {
 	return Topic{
 		Topic: Message{
-			Topic: message.Topic,
+			Topic: event.Topic,
 		},
+		Deleted: event.Deleted,
 	}
 }
 
-func ConvertToStoreFilter(request MessageRequest) (result store.Filters) {
-	if len(request.Filters) == 0 {
-		return store.Filters{}
+func ConvertToWsTopicConfig(topic string, entries []provider.TopicConfigEntry) TopicConfigs {
+	result := TopicConfig{
+		Topic:   topic,
+		Configs: make([]TopicConfigEntry, 0, len(entries)),
 	}
 
-	for _, filter := range request.Filters {
-		if filter.Param == "topic" {
-			result.Topic = filter.Value
-			continue
+	for _, entry := range entries {
+		if entry.IsSensitive {
+			entry.Value = ""
+		}
+		result.Configs = append(result.Configs, TopicConfigEntry(entry))
+	}
+
+	return TopicConfigs{TopicConfig: result}
+}
+
+func ConvertToTopicSpec(request MessageRequest) provider.TopicSpec {
+	return provider.TopicSpec{
+		Topic:             request.Topic,
+		Partitions:        request.Partitions,
+		ReplicationFactor: request.ReplicationFactor,
+		Configs:           request.Configs,
+	}
+}
+
+// ConvertToWsTopicInfo maps kafka metadata of the topic and the last stored offsets of its partitions.
+// A partition without stored messages has storedOffset -1.
+func ConvertToWsTopicInfo(info provider.TopicInfo, storedOffsets map[int]int) TopicInfo {
+	result := TopicInfo{
+		Topic:      info.Topic,
+		Partitions: make([]PartitionInfo, 0, len(info.Partitions)),
+	}
+
+	for _, partition := range info.Partitions {
+		stored := int64(-1)
+		lag := partition.High - partition.Low
+		if offset, ok := storedOffsets[int(partition.Partition)]; ok {
+			stored = int64(offset)
+			lag = partition.High - stored - 1
 		}
 
-		result.Filters = append(result.Filters, store.Filter{
-			FieldName:  filter.Param,
-			FieldValue: filter.Value,
-			Comparator: New(filter.Operator, getCastType(filter.Param)),
+		if lag < 0 {
+			lag = 0
+		}
+
+		result.Partitions = append(result.Partitions, PartitionInfo{
+			Partition:    partition.Partition,
+			Leader:       partition.Leader,
+			Replicas:     partition.Replicas,
+			Isr:          partition.Isr,
+			Low:          partition.Low,
+			High:         partition.High,
+			StoredOffset: stored,
+			StoreLag:     lag,
 		})
 	}
-	return
+
+	return result
 }
 
-func getCastType(fieldName string) CastType {
-	for t, v := range messageFilterFields {
-		if strings.Contains(v, strings.ToLower(fieldName)) {
-			return t
+func ConvertToWsConsumerGroups(groups []provider.ConsumerGroup) ConsumerGroups {
+	result := ConsumerGroups{ConsumerGroups: make([]ConsumerGroup, 0, len(groups))}
+
+	for _, group := range groups {
+		wsGroup := ConsumerGroup{
+			GroupID:  group.GroupID,
+			State:    group.State,
+			Protocol: group.Protocol,
+			Members:  make([]GroupMember, 0, len(group.Members)),
+			Offsets:  make([]GroupOffset, 0, len(group.Offsets)),
+			TotalLag: group.TotalLag,
+		}
+
+		for _, member := range group.Members {
+			wsGroup.Members = append(wsGroup.Members, GroupMember(member))
+		}
+
+		for _, offset := range group.Offsets {
+			wsGroup.Offsets = append(wsGroup.Offsets, GroupOffset(offset))
 		}
+		result.ConsumerGroups = append(result.ConsumerGroups, wsGroup)
+	}
+
+	return result
+}
+
+func ConvertToOffsetResetRequest(request MessageRequest) provider.OffsetResetRequest {
+	var mode = provider.ResetUnset
+	switch request.ResetMode {
+	case ResetModeEarliest:
+		mode = provider.ResetToEarliest
+	case ResetModeLatest:
+		mode = provider.ResetToLatest
+	case ResetModeTimestamp:
+		mode = provider.ResetToTimestamp
+	case ResetModeOffset:
+		mode = provider.ResetToOffset
+	case ResetModeShift:
+		mode = provider.ResetShiftBy
+	}
+
+	return provider.OffsetResetRequest{
+		Group:      request.Group,
+		Topic:      request.Topic,
+		Partitions: request.ResetPartitions,
+		Mode:       mode,
+		Timestamp:  request.Timestamp,
+		Offset:     request.Offset,
+		DryRun:     request.DryRun,
+	}
+}
+
+func ConvertToWsOffsetsReset(request MessageRequest, resets []provider.OffsetReset) OffsetsResets {
+	result := OffsetsReset{
+		Group:   request.Group,
+		DryRun:  request.DryRun,
+		Offsets: make([]OffsetReset, 0, len(resets)),
+	}
+
+	for _, reset := range resets {
+		result.Offsets = append(result.Offsets, OffsetReset(reset))
+	}
+
+	return OffsetsResets{OffsetsReset: result}
+}
+
+func ConvertToWsStoreUsage(usage store.Usage) StoreUsages {
+	result := StoreUsage{
+		Topics:   make([]TopicUsage, 0, len(usage.Topics)),
+		Messages: usage.Messages,
+		Bytes:    usage.Bytes,
+	}
+
+	for _, topic := range usage.Topics {
+		result.Topics = append(result.Topics, TopicUsage(topic))
+	}
+
+	return StoreUsages{StoreUsage: result}
+}
+
+func ConvertToWsIngest(snapshot ingest.Snapshot) Ingest {
+	return Ingest{Ingest: IngestMetrics(snapshot)}
+}
+
+func ConvertToWsHealth(components []health.Component, ready bool, lag int64, snapshot ingest.Snapshot) Health {
+	health := Health{Status: healthOk, Lag: lag, Ingest: IngestMetrics(snapshot)}
+	if !ready {
+		health.Status = healthDegraded
+	}
+
+	for _, component := range components {
+		health.Components = append(health.Components, ComponentHealth(component))
+	}
+	return health
+}
+
+func ConvertToWsLagging(dropped int64, policy OverflowPolicy, queueSize int) Lagging {
+	return Lagging{Lagging: LaggingInfo{Dropped: dropped, Policy: string(policy), QueueSize: queueSize}}
+}
+
+// ConvertToWsFeedLagging reports the messages which the change feed dropped, it keeps the older messages.
+func ConvertToWsFeedLagging(dropped int64) Lagging {
+	return Lagging{Lagging: LaggingInfo{
+		Dropped:   dropped,
+		Policy:    "dropNewest",
+		QueueSize: store.SubscriberCapacity,
+		Source:    "changeFeed",
+	}}
+}
+
+func ConvertToWsSampling(report samplingReport) Sampling {
+	mode := string(report.Mode)
+	if mode == "" {
+		mode = "rate"
+	}
+
+	return Sampling{Sampling: SamplingInfo{
+		Mode:         mode,
+		MaxRate:      report.MaxRate,
+		Passed:       report.Passed,
+		Skipped:      report.Skipped,
+		TotalSkipped: report.TotalSkipped,
+	}}
+}
+
+func ConvertToWsConnections(infos []connectionInfo, now time.Time) Connections {
+	result := Connections{Connections: make([]Connection, 0, len(infos))}
+	for _, info := range infos {
+		result.Connections = append(result.Connections, Connection{
+			ID:            info.ID.String(),
+			RemoteAddr:    info.RemoteAddr,
+			User:          info.User,
+			ConnectedAt:   info.ConnectedAt,
+			LastActivity:  info.LastActivity,
+			IdleMs:        now.Sub(info.LastActivity).Milliseconds(),
+			BytesSent:     info.BytesSent,
+			Queued:        info.Queued,
+			Dropped:       info.Dropped,
+			Subscriptions: info.Subscriptions,
+		})
+	}
+	return result
+}
+
+func ConvertToSearchQuery(request MessageRequest) search.Query {
+	query := search.Query{
+		Text:  request.Query,
+		Topic: request.Topic,
+		Limit: request.Limit,
+	}
+
+	if request.From > 0 {
+		query.From = time.Unix(0, request.From*int64(time.Millisecond))
+	}
+	if request.To > 0 {
+		query.To = time.Unix(0, request.To*int64(time.Millisecond))
+	}
+
+	return query
+}
+
+func ConvertToWsSearch(query string, results search.Results) Searches {
+	result := SearchResults{
+		Query:           query,
+		Results:         make([]SearchResult, 0, len(results.Results)),
+		IndexedFrom:     results.From,
+		IndexedTo:       results.To,
+		Indexed:         results.Documents,
+		Loading:         results.Loading,
+		SkippedBatches:  results.SkippedBatches,
+		SkippedMessages: results.SkippedMessages,
+		Note:            searchNote,
+	}
+
+	for _, item := range results.Results {
+		result.Results = append(result.Results, SearchResult(item))
+	}
+
+	return Searches{Search: result}
+}
+
+// ConvertToWsExport returns the link to download the export of the request.
+func ConvertToWsExport(request MessageRequest) Exports {
+	query := url.Values{}
+	query.Set("format", request.Format)
+
+	if request.Topic != "" {
+		query.Set("topic", request.Topic)
+	}
+	if len(request.Filters) > 0 {
+		query.Set("filters", string(toJson(request.Filters)))
+	}
+	if len(request.Columns) > 0 {
+		query.Set("columns", strings.Join(request.Columns, ","))
+	}
+
+	return Exports{Export: ExportLink{Format: request.Format, URL: exportPath + "?" + query.Encode()}}
+}
+
+func ConvertToReplayRequest(request MessageRequest) provider.ReplayRequest {
+	return provider.ReplayRequest{
+		TargetTopic:       request.TargetTopic,
+		Key:               request.Key,
+		DropKey:           request.DropKey,
+		Headers:           request.Headers,
+		DropHeaders:       request.DropHeaders,
+		PreservePartition: request.PreservePartition,
+		PreserveTimestamp: request.PreserveTimestamp,
+		RatePerSecond:     request.Rate,
+		DryRun:            request.DryRun,
+	}
+}
+
+func ConvertToWsReplay(progress provider.ReplayProgress) Replays {
+	return Replays{Replay: ReplayProgress(progress)}
+}
+
+func ConvertToWsTrace(trace trace.Trace) Traces {
+	result := Trace{
+		CorrelationID: trace.Correlation,
+		Steps:         make([]TraceStep, 0, len(trace.Steps)),
+		Missing:       make([]string, 0, len(trace.Missing)),
+		DurationMs:    trace.Duration.Milliseconds(),
+		Since:         trace.Since,
+		Undecoded:     trace.Undecoded,
+		Note:          traceNote,
+	}
+
+	for _, step := range trace.Steps {
+		result.Steps = append(result.Steps, TraceStep{
+			Topic:      step.Topic,
+			Partition:  step.Partition,
+			Offset:     step.Offset,
+			At:         step.At,
+			GapMs:      step.Gap.Milliseconds(),
+			Expected:   step.Expected,
+			OutOfOrder: step.OutOfOrder,
+		})
+	}
+	result.Missing = append(result.Missing, trace.Missing...)
+
+	return Traces{Trace: result}
+}
+
+func ConvertToStatsQuery(request MessageRequest) stats.Query {
+	query := stats.Query{
+		Topic:       request.Topic,
+		Resolution:  request.Resolution,
+		ByPartition: request.ByPartition,
+	}
+
+	if query.Resolution == "" {
+		query.Resolution = stats.DefaultResolution
+	}
+
+	if request.From > 0 {
+		query.From = time.Unix(0, request.From*int64(time.Millisecond))
+	}
+	if request.To > 0 {
+		query.To = time.Unix(0, request.To*int64(time.Millisecond))
+	}
+
+	return query
+}
+
+func ConvertToWsStats(query stats.Query, series []stats.Series) Stats {
+	result := TopicStats{
+		Resolution: query.Resolution,
+		Series:     make([]StatsSeries, 0, len(series)),
+	}
+
+	for _, item := range series {
+		converted := StatsSeries{
+			Topic:       item.Topic,
+			Partition:   item.Partition,
+			LastMessage: item.LastMessage,
+			Buckets:     make([]StatsBucket, 0, len(item.Buckets)),
+		}
+
+		for _, bucket := range item.Buckets {
+			converted.Buckets = append(converted.Buckets, StatsBucket{
+				Start:   bucket.Start,
+				Count:   bucket.Count,
+				Bytes:   bucket.Bytes,
+				MinSize: bucket.MinSize,
+				AvgSize: bucket.AvgSize(),
+				MaxSize: bucket.MaxSize,
+			})
+		}
+
+		result.Series = append(result.Series, converted)
+	}
+
+	return Stats{Stats: result}
+}
+
+func ConvertToStoreFilter(request MessageRequest, payloadDecoder store.PayloadDecoder, headerEncoding string) store.Filters {
+	params := make([]store.FilterParam, 0, len(request.Filters))
+	for _, filter := range request.Filters {
+		params = append(params, store.FilterParam{Param: filter.Param, Operator: filter.Operator.String(), Value: filter.Value})
 	}
-	return CastTypeStr
+	return store.NewFilters(params, payloadDecoder, headerEncoding)
 }
@@ -0,0 +1,127 @@
+package ws
+
+import "sync"
+
+// OverflowPolicy is what the outbound queue of a socket does with a live message when the queue is full.
+type OverflowPolicy string
+
+const (
+	// OverflowDropOldest drops the oldest queued live message
+	OverflowDropOldest OverflowPolicy = "dropOldest"
+	// OverflowCoalesce replaces the queued update of the same state, e.g. the consumer groups, and drops the oldest
+	// live message when there is no such update
+	OverflowCoalesce OverflowPolicy = "coalesce"
+	// OverflowDisconnect closes the socket
+	OverflowDisconnect OverflowPolicy = "disconnect"
+)
+
+func ParseOverflowPolicy(value string) (OverflowPolicy, bool) {
+	switch policy := OverflowPolicy(value); policy {
+	case OverflowDropOldest, OverflowCoalesce, OverflowDisconnect:
+		return policy, true
+	default:
+		return OverflowDropOldest, false
+	}
+}
+
+type outbound struct {
+	payload []byte
+	// live messages are pushed by the subscriptions and may be dropped, command responses are always sent
+	live bool
+	// key identifies the state which a live message updates, messages of the same key are coalesced
+	key string
+}
+
+// outbox is the bounded queue of the messages to the socket, the socket writer takes them when it is ready.
+type outbox struct {
+	mutex    sync.Mutex
+	queue    []outbound
+	capacity int
+	policy   OverflowPolicy
+	dropped  int64
+	total    int64
+	ready    chan struct{}
+	done     chan struct{}
+	closed   bool
+}
+
+func newOutbox(capacity int, policy OverflowPolicy) *outbox {
+	return &outbox{
+		queue:    make([]outbound, 0, capacity),
+		capacity: capacity,
+		policy:   policy,
+		ready:    make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+}
+
+// push queues the message. It returns false when the queue of the disconnect policy overflows or the outbox is closed.
+func (outbox *outbox) push(message outbound) bool {
+	outbox.mutex.Lock()
+	defer outbox.mutex.Unlock()
+
+	if outbox.closed {
+		return false
+	}
+
+	if message.live && message.key != "" && outbox.policy == OverflowCoalesce {
+		for i := range outbox.queue {
+			if outbox.queue[i].key == message.key {
+				outbox.queue[i] = message
+				return true
+			}
+		}
+	}
+
+	if message.live && len(outbox.queue) >= outbox.capacity {
+		if outbox.policy == OverflowDisconnect {
+			return false
+		}
+		outbox.dropOldest()
+	}
+
+	outbox.queue = append(outbox.queue, message)
+	select {
+	case outbox.ready <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+func (outbox *outbox) dropOldest() {
+	for i := range outbox.queue {
+		if outbox.queue[i].live {
+			outbox.queue = append(outbox.queue[:i], outbox.queue[i+1:]...)
+			outbox.dropped++
+			outbox.total++
+			return
+		}
+	}
+}
+
+// take returns the queued messages and the number of the messages dropped since the previous take.
+func (outbox *outbox) take() ([]outbound, int64) {
+	outbox.mutex.Lock()
+	defer outbox.mutex.Unlock()
+
+	messages, dropped := outbox.queue, outbox.dropped
+	outbox.queue, outbox.dropped = make([]outbound, 0, outbox.capacity), 0
+	return messages, dropped
+}
+
+// stats returns the number of the queued messages and of all the dropped ones.
+func (outbox *outbox) stats() (int, int64) {
+	outbox.mutex.Lock()
+	defer outbox.mutex.Unlock()
+	return len(outbox.queue), outbox.total
+}
+
+func (outbox *outbox) close() {
+	outbox.mutex.Lock()
+	defer outbox.mutex.Unlock()
+
+	if !outbox.closed {
+		outbox.closed = true
+		close(outbox.done)
+	}
+}
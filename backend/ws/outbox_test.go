@@ -0,0 +1,161 @@
+package ws
+
+import "testing"
+
+func TestParseOverflowPolicy(t *testing.T) {
+	tests := []struct {
+		value  string
+		policy OverflowPolicy
+		ok     bool
+	}{
+		{value: "dropOldest", policy: OverflowDropOldest, ok: true},
+		{value: "coalesce", policy: OverflowCoalesce, ok: true},
+		{value: "disconnect", policy: OverflowDisconnect, ok: true},
+		{value: "block", policy: OverflowDropOldest},
+		{value: "", policy: OverflowDropOldest},
+	}
+
+	for _, test := range tests {
+		if policy, ok := ParseOverflowPolicy(test.value); policy != test.policy || ok != test.ok {
+			t.Errorf("%q: got %s %t, want %s %t", test.value, policy, ok, test.policy, test.ok)
+		}
+	}
+}
+
+func TestOutbox(t *testing.T) {
+	var (
+		live     = func(payload string) outbound { return outbound{payload: []byte(payload), live: true} }
+		keyed    = func(payload, key string) outbound { return outbound{payload: []byte(payload), live: true, key: key} }
+		response = func(payload string) outbound { return outbound{payload: []byte(payload)} }
+	)
+
+	tests := []struct {
+		name     string
+		policy   OverflowPolicy
+		messages []outbound
+		// rejected is the index of the first message which push rejects, -1 when every message is queued
+		rejected int
+		queued   []string
+		dropped  int64
+	}{
+		{
+			name:     "within capacity",
+			policy:   OverflowDropOldest,
+			messages: []outbound{live("1"), live("2")},
+			rejected: -1,
+			queued:   []string{"1", "2"},
+		},
+		{
+			name:     "drop oldest",
+			policy:   OverflowDropOldest,
+			messages: []outbound{live("1"), live("2"), live("3"), live("4")},
+			rejected: -1,
+			queued:   []string{"2", "3", "4"},
+			dropped:  1,
+		},
+		{
+			name:     "responses are not dropped",
+			policy:   OverflowDropOldest,
+			messages: []outbound{response("r1"), live("1"), live("2"), live("3"), response("r2")},
+			rejected: -1,
+			queued:   []string{"r1", "2", "3", "r2"},
+			dropped:  1,
+		},
+		{
+			name:     "coalesce the same state",
+			policy:   OverflowCoalesce,
+			messages: []outbound{keyed("groups 1", "groups"), live("1"), keyed("groups 2", "groups"), live("2")},
+			rejected: -1,
+			queued:   []string{"groups 2", "1", "2"},
+		},
+		{
+			name:     "coalesce drops the oldest without the state",
+			policy:   OverflowCoalesce,
+			messages: []outbound{live("1"), live("2"), live("3"), keyed("groups", "groups")},
+			rejected: -1,
+			queued:   []string{"2", "3", "groups"},
+			dropped:  1,
+		},
+		{
+			name:     "drop oldest does not coalesce",
+			policy:   OverflowDropOldest,
+			messages: []outbound{keyed("groups 1", "groups"), keyed("groups 2", "groups")},
+			rejected: -1,
+			queued:   []string{"groups 1", "groups 2"},
+		},
+		{
+			name:     "disconnect",
+			policy:   OverflowDisconnect,
+			messages: []outbound{live("1"), live("2"), live("3"), live("4")},
+			rejected: 3,
+			queued:   []string{"1", "2", "3"},
+		},
+		{
+			name:     "disconnect queues the responses",
+			policy:   OverflowDisconnect,
+			messages: []outbound{live("1"), live("2"), live("3"), response("r")},
+			rejected: -1,
+			queued:   []string{"1", "2", "3", "r"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			current := newOutbox(3, test.policy)
+
+			rejected := -1
+			for i, message := range test.messages {
+				if !current.push(message) && rejected < 0 {
+					rejected = i
+				}
+			}
+
+			if rejected != test.rejected {
+				t.Errorf("rejected: got %d, want %d", rejected, test.rejected)
+			}
+
+			if queued, total := current.stats(); queued != len(test.queued) || total != test.dropped {
+				t.Errorf("stats: got %d queued, %d dropped", queued, total)
+			}
+
+			messages, dropped := current.take()
+			if dropped != test.dropped {
+				t.Errorf("dropped: got %d, want %d", dropped, test.dropped)
+			}
+
+			var queued []string
+			for _, message := range messages {
+				queued = append(queued, string(message.payload))
+			}
+
+			if len(queued) != len(test.queued) {
+				t.Fatalf("queued: got %v, want %v", queued, test.queued)
+			}
+			for i := range queued {
+				if queued[i] != test.queued[i] {
+					t.Fatalf("queued: got %v, want %v", queued, test.queued)
+				}
+			}
+
+			if messages, dropped = current.take(); len(messages) != 0 || dropped != 0 {
+				t.Errorf("second take: got %d messages, %d dropped", len(messages), dropped)
+			}
+		})
+	}
+}
+
+func TestOutboxClose(t *testing.T) {
+	current := newOutbox(1, OverflowDropOldest)
+	current.close()
+	current.close()
+
+	select {
+	case <-current.done:
+	default:
+		t.Fatal("done is not closed")
+	}
+
+	if current.push(outbound{payload: []byte("1")}) {
+		t.Error("closed outbox queues the message")
+	}
+}
@@ -0,0 +1,185 @@
+package ws
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+	"github.com/google/uuid"
+)
+
+// writeTimeout bounds a write to the socket, the socket which does not take the frame in time is broken.
+const writeTimeout = 10 * time.Second
+
+var (
+	errTooManyConnections     = errors.New("too many connections")
+	errTooManyUserConnections = errors.New("too many connections of the user")
+)
+
+// connection is the socket with its statistics. Writes of the messages and the control frames are serialized.
+type connection struct {
+	id           uuid.UUID
+	conn         net.Conn
+	remoteAddr   string
+	user         string
+	connectedAt  time.Time
+	bytesSent    int64
+	lastActivity int64
+	mutex        sync.Mutex
+	outbox       *outbox
+	// subscriptions are the live subscriptions by the command, e.g. the topic of the messages command
+	subscriptions      map[string]string
+	subscriptionsMutex sync.Mutex
+}
+
+type connectionInfo struct {
+	ID            uuid.UUID
+	RemoteAddr    string
+	User          string
+	ConnectedAt   time.Time
+	LastActivity  time.Time
+	BytesSent     int64
+	Queued        int
+	Dropped       int64
+	Subscriptions map[string]string
+}
+
+func newConnection(conn net.Conn, remoteAddr string, user string, outbox *outbox) *connection {
+	now := time.Now()
+	return &connection{
+		id:            uuid.New(),
+		conn:          conn,
+		remoteAddr:    remoteAddr,
+		user:          user,
+		connectedAt:   now,
+		lastActivity:  now.UnixNano(),
+		outbox:        outbox,
+		subscriptions: make(map[string]string),
+	}
+}
+
+func (connection *connection) write(opCode ws.OpCode, payload []byte) error {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+
+	if err := connection.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return err
+	}
+
+	if err := wsutil.WriteServerMessage(connection.conn, opCode, payload); err != nil {
+		return err
+	}
+
+	atomic.AddInt64(&connection.bytesSent, int64(len(payload)))
+	return nil
+}
+
+// touch updates the last activity of the socket, only the commands of the client are activity.
+func (connection *connection) touch() {
+	atomic.StoreInt64(&connection.lastActivity, time.Now().UnixNano())
+}
+
+func (connection *connection) subscribe(command WsCommandType, value string) {
+	connection.subscriptionsMutex.Lock()
+	connection.subscriptions[command.String()] = value
+	connection.subscriptionsMutex.Unlock()
+}
+
+func (connection *connection) info() connectionInfo {
+	connection.subscriptionsMutex.Lock()
+	subscriptions := make(map[string]string, len(connection.subscriptions))
+	for command, value := range connection.subscriptions {
+		subscriptions[command] = value
+	}
+	connection.subscriptionsMutex.Unlock()
+
+	queued, dropped := connection.outbox.stats()
+	return connectionInfo{
+		ID:            connection.id,
+		RemoteAddr:    connection.remoteAddr,
+		User:          connection.user,
+		ConnectedAt:   connection.connectedAt,
+		LastActivity:  time.Unix(0, atomic.LoadInt64(&connection.lastActivity)),
+		BytesSent:     atomic.LoadInt64(&connection.bytesSent),
+		Queued:        queued,
+		Dropped:       dropped,
+		Subscriptions: subscriptions,
+	}
+}
+
+// registry keeps the open sockets and limits their number overall and per user. Zero limit is unlimited.
+type registry struct {
+	mutex          sync.RWMutex
+	connections    map[uuid.UUID]*connection
+	users          map[string]int
+	maxConnections int
+	maxPerUser     int
+}
+
+func newRegistry(maxConnections int, maxPerUser int) *registry {
+	return &registry{
+		connections:    make(map[uuid.UUID]*connection),
+		users:          make(map[string]int),
+		maxConnections: maxConnections,
+		maxPerUser:     maxPerUser,
+	}
+}
+
+func (registry *registry) add(connection *connection) error {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	if registry.maxConnections > 0 && len(registry.connections) >= registry.maxConnections {
+		return errTooManyConnections
+	}
+
+	if registry.maxPerUser > 0 && registry.users[connection.user] >= registry.maxPerUser {
+		return errTooManyUserConnections
+	}
+
+	registry.connections[connection.id] = connection
+	registry.users[connection.user]++
+	return nil
+}
+
+func (registry *registry) remove(id uuid.UUID) (*connection, bool) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	current, ok := registry.connections[id]
+	if !ok {
+		return nil, false
+	}
+
+	delete(registry.connections, id)
+	if registry.users[current.user]--; registry.users[current.user] <= 0 {
+		delete(registry.users, current.user)
+	}
+	return current, true
+}
+
+func (registry *registry) get(id uuid.UUID) (*connection, bool) {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+
+	current, ok := registry.connections[id]
+	return current, ok
+}
+
+// all returns the sockets in the order of the connection time.
+func (registry *registry) all() []*connection {
+	registry.mutex.RLock()
+	result := make([]*connection, 0, len(registry.connections))
+	for _, current := range registry.connections {
+		result = append(result, current)
+	}
+	registry.mutex.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool { return result[i].connectedAt.Before(result[j].connectedAt) })
+	return result
+}
@@ -0,0 +1,583 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/export"
+	"backend/provider"
+	"backend/search"
+	"backend/store"
+	"backend/trace"
+
+	"github.com/gobwas/ws"
+	rethink "gopkg.in/rethinkdb/rethinkdb-go.v6"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	exportPath       = "/api/export"
+	exportFlushCount = 1000
+	healthOk         = "ok"
+	healthDegraded   = "degraded"
+)
+
+// TopicInfo serves GET /api/topic-info?topic=<name>. Without the topic parameter all topics are returned.
+func (wsService *WsService) TopicInfo(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writeJson(writer, http.StatusMethodNotAllowed, Error{Error: "method not allowed"})
+		return
+	}
+
+	infos, err := wsService.topicInfos(request.URL.Query().Get("topic"))
+	if err != nil {
+		log.Warnf("Topic info error: %s", err.Error())
+		writeJson(writer, http.StatusServiceUnavailable, Error{Error: err.Error()})
+		return
+	}
+
+	writeJson(writer, http.StatusOK, TopicInfos{TopicInfo: infos})
+}
+
+// StoreUsage serves GET /api/store/usage with the stored messages and payload bytes per topic.
+func (wsService *WsService) StoreUsage(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writeJson(writer, http.StatusMethodNotAllowed, Error{Error: "method not allowed"})
+		return
+	}
+
+	usage, err := wsService.storeSvc.Usage()
+	if err != nil {
+		log.Warnf("Store usage error: %s", err.Error())
+		writeJson(writer, http.StatusServiceUnavailable, Error{Error: err.Error()})
+		return
+	}
+
+	writeJson(writer, http.StatusOK, ConvertToWsStoreUsage(usage))
+}
+
+// IngestMetrics serves GET /api/ingest/metrics with the ingest throughput and queue depth.
+func (wsService *WsService) IngestMetrics(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writeJson(writer, http.StatusMethodNotAllowed, Error{Error: "method not allowed"})
+		return
+	}
+
+	writeJson(writer, http.StatusOK, ConvertToWsIngest(wsService.ingestSvc.Snapshot()))
+}
+
+// Healthz serves GET /healthz, the backend is alive while it responds. Components which are down degrade the status,
+// the backend reconnects them in the background.
+func (wsService *WsService) Healthz(writer http.ResponseWriter, request *http.Request) {
+	writeJson(writer, http.StatusOK, wsService.health())
+}
+
+// Readyz serves GET /readyz, it responds with 503 while any component is down.
+func (wsService *WsService) Readyz(writer http.ResponseWriter, request *http.Request) {
+	var (
+		health = wsService.health()
+		status = http.StatusOK
+	)
+
+	if health.Status != healthOk {
+		status = http.StatusServiceUnavailable
+	}
+	writeJson(writer, status, health)
+}
+
+func (wsService *WsService) health() Health {
+	components, ready := wsService.healthSvc.Components()
+	return ConvertToWsHealth(components, ready, wsService.healthSvc.Lag(), wsService.ingestSvc.Snapshot())
+}
+
+// Connections serves GET /api/connections with the open sockets, DELETE /api/connections?id=<id> closes the socket and
+// DELETE /api/connections?idle=<duration> closes the sockets idle for longer than the duration, e.g. 30m.
+func (wsService *WsService) Connections(writer http.ResponseWriter, request *http.Request) {
+	var (
+		now         = time.Now()
+		connections = wsService.registry.all()
+	)
+
+	// the sockets show the users and their addresses, so they are admin actions like the topic administration
+	if !wsService.configure.Config.AdminEnabled {
+		writeJson(writer, adminErrorStatus(provider.ErrAdminDisabled), Error{Error: provider.ErrAdminDisabled.Error()})
+		return
+	}
+
+	switch request.Method {
+	case http.MethodGet:
+		infos := make([]connectionInfo, 0, len(connections))
+		for _, current := range connections {
+			infos = append(infos, current.info())
+		}
+		writeJson(writer, http.StatusOK, ConvertToWsConnections(infos, now))
+
+	case http.MethodDelete:
+		var (
+			query  = request.URL.Query()
+			closed = ClosedConnections{Closed: []string{}}
+			idle   time.Duration
+			err    error
+		)
+
+		if query.Get("id") == "" && query.Get("idle") == "" {
+			writeJson(writer, http.StatusBadRequest, Error{Error: "id or idle is required"})
+			return
+		}
+
+		if value := query.Get("idle"); value != "" {
+			if idle, err = time.ParseDuration(value); err != nil {
+				writeJson(writer, http.StatusBadRequest, Error{Error: err.Error()})
+				return
+			}
+
+			if idle <= 0 {
+				writeJson(writer, http.StatusBadRequest, Error{Error: "idle must be positive"})
+				return
+			}
+		}
+
+		for _, current := range connections {
+			info := current.info()
+			if value := query.Get("id"); value != "" && value != info.ID.String() {
+				continue
+			}
+			if idle > 0 && now.Sub(info.LastActivity) < idle {
+				continue
+			}
+
+			wsService.closeSocketWithReason(info.ID, ws.StatusNormalClosure, kickReason)
+			closed.Closed = append(closed.Closed, info.ID.String())
+		}
+		writeJson(writer, http.StatusOK, closed)
+
+	default:
+		writeJson(writer, http.StatusMethodNotAllowed, Error{Error: "method not allowed"})
+	}
+}
+
+// Search serves GET /api/search?q=<text>&topic=<name>&from=<ms>&to=<ms>&limit=<count>.
+func (wsService *WsService) Search(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writeJson(writer, http.StatusMethodNotAllowed, Error{Error: "method not allowed"})
+		return
+	}
+
+	var (
+		query   = request.URL.Query()
+		message = MessageRequest{Command: WsCommandTypeSearch, Query: query.Get("q"), Topic: query.Get("topic")}
+		err     error
+	)
+
+	for name, value := range map[string]*int64{"from": &message.From, "to": &message.To} {
+		if query.Get(name) == "" {
+			continue
+		}
+
+		if *value, err = strconv.ParseInt(query.Get(name), 10, 64); err != nil {
+			writeJson(writer, http.StatusBadRequest, Error{Error: fmt.Sprintf("invalid %s: %s", name, query.Get(name))})
+			return
+		}
+	}
+
+	if query.Get("limit") != "" {
+		if message.Limit, err = strconv.Atoi(query.Get("limit")); err != nil {
+			writeJson(writer, http.StatusBadRequest, Error{Error: "invalid limit: " + query.Get("limit")})
+			return
+		}
+	}
+
+	results, err := wsService.searchSvc.Search(ConvertToSearchQuery(message))
+	switch {
+	case errors.Is(err, search.ErrEmptyQuery):
+		writeJson(writer, http.StatusBadRequest, Error{Error: err.Error()})
+	case errors.Is(err, search.ErrSearchDisabled):
+		writeJson(writer, http.StatusNotFound, Error{Error: err.Error()})
+	case err != nil:
+		writeJson(writer, http.StatusInternalServerError, Error{Error: err.Error()})
+	default:
+		writeJson(writer, http.StatusOK, ConvertToWsSearch(message.Query, results))
+	}
+}
+
+// Export serves GET /api/export?format=<jsonl|csv|bundle>&topic=<name>&filters=<json filters>&columns=<a,b> and
+// POST /api/export with the export command as the body. Messages are streamed as they are read from the store.
+func (wsService *WsService) Export(writer http.ResponseWriter, request *http.Request) {
+	var cmd MessageRequest
+
+	switch request.Method {
+	case http.MethodGet:
+		query := request.URL.Query()
+		cmd.Format, cmd.Topic = query.Get("format"), query.Get("topic")
+
+		if filters := query.Get("filters"); filters != "" {
+			if err := json.Unmarshal([]byte(filters), &cmd.Filters); err != nil {
+				writeJson(writer, http.StatusBadRequest, Error{Error: "invalid filters: " + err.Error()})
+				return
+			}
+		}
+
+		if columns := query.Get("columns"); columns != "" {
+			cmd.Columns = strings.Split(columns, ",")
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(request.Body).Decode(&cmd); err != nil {
+			writeJson(writer, http.StatusBadRequest, Error{Error: err.Error()})
+			return
+		}
+	default:
+		writeJson(writer, http.StatusMethodNotAllowed, Error{Error: "method not allowed"})
+		return
+	}
+
+	if cmd.Topic != "" {
+		cmd.Filters = append(cmd.Filters, Filter{Param: "topic", Operator: OperatorTypeEq, Value: cmd.Topic})
+	}
+
+	var (
+		flusher, _       = writer.(http.Flusher)
+		contentType, ext = export.ContentType(cmd.Format)
+		exported         int
+	)
+
+	exportWriter, err := export.New(cmd.Format, cmd.Columns, wsService.decoderSvc, writer)
+	if err != nil {
+		writeJson(writer, http.StatusBadRequest, Error{Error: err.Error()})
+		return
+	}
+
+	writer.Header().Set("Content-Type", contentType)
+	writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s%s\"", exportName(cmd.Topic), ext))
+	writer.WriteHeader(http.StatusOK)
+
+	err = wsService.storeSvc.Export(request.Context(), ConvertToStoreFilter(cmd, wsService.decoderSvc, wsService.configure.Config.HeaderBinaryEncoding), func(message store.Message) error {
+		if err := exportWriter.Write(message); err != nil {
+			return err
+		}
+
+		if exported++; exported%exportFlushCount == 0 && flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		// the status is already sent, the client gets a truncated file
+		log.Warnf("Export error after %d messages: %s", exported, err.Error())
+	}
+
+	if err = exportWriter.Close(); err != nil {
+		log.Warnf("Export close error: %s", err.Error())
+	}
+	log.Infof("Export %d messages of '%s'", exported, cmd.Topic)
+}
+
+// Replay serves POST /api/replay with the replay command as the body. The response is the final progress.
+func (wsService *WsService) Replay(writer http.ResponseWriter, request *http.Request) {
+	var cmd MessageRequest
+
+	if request.Method != http.MethodPost {
+		writeJson(writer, http.StatusMethodNotAllowed, Error{Error: "method not allowed"})
+		return
+	}
+
+	if err := json.NewDecoder(request.Body).Decode(&cmd); err != nil {
+		writeJson(writer, http.StatusBadRequest, Error{Error: err.Error()})
+		return
+	}
+
+	filters := ConvertToStoreFilter(cmd, wsService.decoderSvc, wsService.configure.Config.HeaderBinaryEncoding)
+	if err := checkReplay(cmd, filters.Topic); err != nil {
+		writeJson(writer, adminErrorStatus(err), Error{Error: err.Error()})
+		return
+	}
+
+	wsService.serveReplay(writer, request, cmd, func(fn func(store.Message) error) error {
+		return wsService.storeSvc.Export(request.Context(), filters, fn)
+	})
+}
+
+// ReplayImport serves POST /api/replay/import?targetTopic=<name>&topic=<name>&confirm=<name>&dryRun=true&rate=100
+// with the replay bundle or the jsonl export as the body. Without the target topic only the messages of the topic
+// are produced back to it.
+func (wsService *WsService) ReplayImport(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writeJson(writer, http.StatusMethodNotAllowed, Error{Error: "method not allowed"})
+		return
+	}
+
+	var (
+		query = request.URL.Query()
+		cmd   = MessageRequest{
+			Command:           WsCommandTypeReplay,
+			Topic:             query.Get("topic"),
+			TargetTopic:       query.Get("targetTopic"),
+			Confirm:           query.Get("confirm"),
+			DryRun:            query.Get("dryRun") == "true",
+			DropKey:           query.Get("dropKey") == "true",
+			DropHeaders:       query.Get("dropHeaders") == "true",
+			PreservePartition: query.Get("preservePartition") == "true",
+			PreserveTimestamp: query.Get("preserveTimestamp") == "true",
+		}
+	)
+
+	if rate := query.Get("rate"); rate != "" {
+		var err error
+		if cmd.Rate, err = strconv.Atoi(rate); err != nil {
+			writeJson(writer, http.StatusBadRequest, Error{Error: "invalid rate: " + rate})
+			return
+		}
+	}
+
+	if err := checkReplay(cmd, cmd.Topic); err != nil {
+		writeJson(writer, adminErrorStatus(err), Error{Error: err.Error()})
+		return
+	}
+
+	wsService.serveReplay(writer, request, cmd, func(fn func(store.Message) error) error {
+		return export.ReadBundle(request.Body, func(message store.Message) error {
+			if cmd.TargetTopic == "" && message.Topic != cmd.Topic {
+				return nil
+			}
+			return fn(message)
+		})
+	})
+}
+
+func (wsService *WsService) serveReplay(writer http.ResponseWriter, request *http.Request, cmd MessageRequest, source provider.ReplaySource) {
+	var result provider.ReplayProgress
+
+	err := wsService.adminSvc.Replay(request.Context(), ConvertToReplayRequest(cmd), source, func(progress provider.ReplayProgress) {
+		result = progress
+	})
+
+	switch {
+	case errors.Is(err, provider.ErrAdminDisabled):
+		writeJson(writer, adminErrorStatus(err), Error{Error: err.Error()})
+	case err != nil && result.ID == "":
+		writeJson(writer, http.StatusInternalServerError, Error{Error: err.Error()})
+	case err != nil:
+		writeJson(writer, http.StatusBadGateway, ConvertToWsReplay(result))
+	default:
+		writeJson(writer, http.StatusOK, ConvertToWsReplay(result))
+	}
+}
+
+func exportName(topic string) string {
+	if topic == "" {
+		return "messages"
+	}
+	return topic
+}
+
+// Trace serves GET /api/trace?id=<correlation id> with the messages of the saga.
+func (wsService *WsService) Trace(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writeJson(writer, http.StatusMethodNotAllowed, Error{Error: "method not allowed"})
+		return
+	}
+
+	result, err := wsService.traceSvc.Trace(request.URL.Query().Get("id"))
+	switch {
+	case errors.Is(err, trace.ErrCorrelationRequired):
+		writeJson(writer, http.StatusBadRequest, Error{Error: err.Error()})
+	case errors.Is(err, trace.ErrTraceDisabled):
+		writeJson(writer, http.StatusNotFound, Error{Error: err.Error()})
+	case err != nil:
+		writeJson(writer, http.StatusInternalServerError, Error{Error: err.Error()})
+	default:
+		writeJson(writer, http.StatusOK, ConvertToWsTrace(result))
+	}
+}
+
+// Stats serves GET /api/stats?topic=<name>&resolution=<1m|1h|1d>&from=<ms>&to=<ms>&byPartition=true.
+func (wsService *WsService) Stats(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writeJson(writer, http.StatusMethodNotAllowed, Error{Error: "method not allowed"})
+		return
+	}
+
+	var (
+		query = request.URL.Query()
+		cmd   = MessageRequest{
+			Command:     WsCommandTypeStats,
+			Topic:       query.Get("topic"),
+			Resolution:  query.Get("resolution"),
+			ByPartition: query.Get("byPartition") == "true",
+		}
+		err error
+	)
+
+	for name, value := range map[string]*int64{"from": &cmd.From, "to": &cmd.To} {
+		if query.Get(name) == "" {
+			continue
+		}
+
+		if *value, err = strconv.ParseInt(query.Get(name), 10, 64); err != nil {
+			writeJson(writer, http.StatusBadRequest, Error{Error: fmt.Sprintf("invalid %s: %s", name, query.Get(name))})
+			return
+		}
+	}
+
+	statsQuery := ConvertToStatsQuery(cmd)
+	series, err := wsService.statsSvc.Stats(statsQuery)
+	if err != nil {
+		writeJson(writer, http.StatusBadRequest, Error{Error: err.Error()})
+		return
+	}
+
+	writeJson(writer, http.StatusOK, ConvertToWsStats(statsQuery, series))
+}
+
+// ConsumerGroups serves GET /api/consumer-groups?group=<id>. Without the group parameter all groups are returned.
+func (wsService *WsService) ConsumerGroups(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writeJson(writer, http.StatusMethodNotAllowed, Error{Error: "method not allowed"})
+		return
+	}
+
+	groups, err := wsService.adminSvc.ConsumerGroups(request.URL.Query().Get("group"))
+	if err != nil {
+		log.Warnf("Consumer groups error: %s", err.Error())
+		writeJson(writer, http.StatusServiceUnavailable, Error{Error: err.Error()})
+		return
+	}
+
+	writeJson(writer, http.StatusOK, ConvertToWsConsumerGroups(groups))
+}
+
+// Topics serves POST /api/topics to create a topic and DELETE /api/topics?topic=<name>&confirm=<name> to delete it.
+func (wsService *WsService) Topics(writer http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodPost:
+		wsService.serveTopicAdmin(writer, request, WsCommandTypeCreateTopic)
+	case http.MethodDelete:
+		wsService.serveTopicAdmin(writer, request, WsCommandTypeDeleteTopic)
+	default:
+		writeJson(writer, http.StatusMethodNotAllowed, Error{Error: "method not allowed"})
+	}
+}
+
+// TopicConfig serves GET /api/topics/config?topic=<name> to describe and PUT /api/topics/config to alter topic configs.
+func (wsService *WsService) TopicConfig(writer http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+		wsService.serveTopicAdmin(writer, request, WsCommandTypeTopicConfig)
+	case http.MethodPut:
+		wsService.serveTopicAdmin(writer, request, WsCommandTypeAlterTopicConfig)
+	default:
+		writeJson(writer, http.StatusMethodNotAllowed, Error{Error: "method not allowed"})
+	}
+}
+
+// TopicPartitions serves POST /api/topics/partitions to increase the partition count.
+func (wsService *WsService) TopicPartitions(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writeJson(writer, http.StatusMethodNotAllowed, Error{Error: "method not allowed"})
+		return
+	}
+
+	wsService.serveTopicAdmin(writer, request, WsCommandTypeCreatePartitions)
+}
+
+// GroupOffsets serves POST /api/consumer-groups/offsets to reset offsets of the group, the body is the resetOffsets command.
+func (wsService *WsService) GroupOffsets(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writeJson(writer, http.StatusMethodNotAllowed, Error{Error: "method not allowed"})
+		return
+	}
+
+	wsService.serveTopicAdmin(writer, request, WsCommandTypeResetOffsets)
+}
+
+// serveTopicAdmin reads the command from the json body or, for the requests without a body, from the query.
+func (wsService *WsService) serveTopicAdmin(writer http.ResponseWriter, request *http.Request, command WsCommandType) {
+	var cmd MessageRequest
+
+	if request.Method == http.MethodGet || request.Method == http.MethodDelete {
+		cmd.Topic = request.URL.Query().Get("topic")
+		cmd.Confirm = request.URL.Query().Get("confirm")
+	} else if err := json.NewDecoder(request.Body).Decode(&cmd); err != nil {
+		writeJson(writer, http.StatusBadRequest, Error{Error: err.Error()})
+		return
+	}
+	cmd.Command = command
+
+	response, err := wsService.topicAdmin(cmd)
+	if err != nil {
+		log.Warnf("Topic admin command %s error: %s", command, err.Error())
+		writeJson(writer, adminErrorStatus(err), Error{Error: err.Error()})
+		return
+	}
+
+	writeJson(writer, http.StatusOK, response)
+}
+
+func adminErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, provider.ErrAdminDisabled):
+		return http.StatusForbidden
+	case errors.Is(err, errTopicRequired), errors.Is(err, errGroupRequired), errors.Is(err, errNotConfirmed),
+		errors.Is(err, provider.ErrReplayRate):
+		return http.StatusBadRequest
+	case errors.Is(err, provider.ErrGroupActive):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// RawMessage serves GET /api/messages/raw?topic=<name>&partition=<n>&offset=<n> to download the message value
+// as it was consumed.
+func (wsService *WsService) RawMessage(writer http.ResponseWriter, request *http.Request) {
+	var (
+		query     = request.URL.Query()
+		partition int
+		offset    int
+		message   store.Message
+		err       error
+	)
+
+	if request.Method != http.MethodGet {
+		writeJson(writer, http.StatusMethodNotAllowed, Error{Error: "method not allowed"})
+		return
+	}
+
+	if partition, err = strconv.Atoi(query.Get("partition")); err != nil {
+		writeJson(writer, http.StatusBadRequest, Error{Error: "invalid partition"})
+		return
+	}
+
+	if offset, err = strconv.Atoi(query.Get("offset")); err != nil {
+		writeJson(writer, http.StatusBadRequest, Error{Error: "invalid offset"})
+		return
+	}
+
+	if message, err = wsService.storeSvc.Message(query.Get("topic"), partition, offset); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, rethink.ErrEmptyResult) {
+			status = http.StatusNotFound
+		}
+		writeJson(writer, status, Error{Error: err.Error()})
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/octet-stream")
+	writer.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%d-%d.bin"`, message.Topic, message.Partition, message.Offset))
+	if _, err = writer.Write(message.Message); err != nil {
+		log.Warnf("Write response error: %s", err.Error())
+	}
+}
+
+func writeJson(writer http.ResponseWriter, status int, body interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	if _, err := writer.Write(toJson(body)); err != nil {
+		log.Warnf("Write response error: %s", err.Error())
+	}
+}
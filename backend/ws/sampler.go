@@ -0,0 +1,173 @@
+package ws
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"time"
+
+	"backend/store"
+)
+
+// SamplingMode selects the live messages of the messages command which are sent to the socket.
+type SamplingMode string
+
+const (
+	// SamplingNone sends the first maxRate messages of every second
+	SamplingNone SamplingMode = ""
+	// SamplingNth sends every sampleEvery-th message
+	SamplingNth SamplingMode = "nth"
+	// SamplingReservoir sends a random sample of maxRate messages of every second at the end of the second
+	SamplingReservoir SamplingMode = "reservoir"
+	// SamplingLatestPerKey sends the latest message of every key of every second at the end of the second
+	SamplingLatestPerKey SamplingMode = "latestPerKey"
+)
+
+var (
+	errUnknownSampling  = errors.New("unknown sampling, use nth, reservoir or latestPerKey")
+	errSampleEvery      = errors.New("nth sampling requires sampleEvery greater than 1")
+	errReservoirMaxRate = errors.New("reservoir sampling requires maxRate")
+)
+
+type sampled struct {
+	sequence int64
+	message  store.Message
+}
+
+type samplingReport struct {
+	Mode         SamplingMode
+	MaxRate      int
+	Passed       int64
+	Skipped      int64
+	TotalSkipped int64
+}
+
+// sampler limits the rate of the live messages. Messages are counted in windows of a second, the reservoir and the
+// latest per key modes keep the messages of the window and send them when the window ends.
+type sampler struct {
+	mode     SamplingMode
+	maxRate  int
+	every    int64
+	sequence int64
+	// passed and skipped are the counters of the current window
+	passed       int64
+	skipped      int64
+	totalSkipped int64
+	window       []sampled
+	latest       map[string]int
+	random       *rand.Rand
+}
+
+// newSampler returns nil when the request neither limits the rate nor samples the messages.
+func newSampler(request MessageRequest) (*sampler, error) {
+	var mode = SamplingMode(request.Sampling)
+
+	switch mode {
+	case SamplingNone:
+		if request.MaxRate <= 0 {
+			return nil, nil
+		}
+	case SamplingNth:
+		if request.SampleEvery <= 1 {
+			return nil, errSampleEvery
+		}
+	case SamplingReservoir:
+		if request.MaxRate <= 0 {
+			return nil, errReservoirMaxRate
+		}
+	case SamplingLatestPerKey:
+	default:
+		return nil, errUnknownSampling
+	}
+
+	return &sampler{
+		mode:    mode,
+		maxRate: request.MaxRate,
+		every:   int64(request.SampleEvery),
+		latest:  make(map[string]int),
+		random:  rand.New(rand.NewSource(time.Now().UnixNano())),
+	}, nil
+}
+
+// offer reports whether the message is sent now. The message which is not sent is either skipped or kept until
+// the end of the window.
+func (sampler *sampler) offer(message store.Message) bool {
+	sampler.sequence++
+
+	switch sampler.mode {
+	case SamplingNth:
+		if sampler.sequence%sampler.every != 0 {
+			sampler.skipped++
+			return false
+		}
+		return sampler.admit()
+
+	case SamplingReservoir:
+		// every message of the window is kept with the probability maxRate/count
+		if len(sampler.window) < sampler.maxRate {
+			sampler.window = append(sampler.window, sampled{sequence: sampler.sequence, message: message})
+			return false
+		}
+
+		sampler.skipped++
+		if i := sampler.random.Int63n(int64(len(sampler.window)) + sampler.skipped); i < int64(sampler.maxRate) {
+			sampler.window[i] = sampled{sequence: sampler.sequence, message: message}
+		}
+		return false
+
+	case SamplingLatestPerKey:
+		key := string(message.Key)
+		if i, ok := sampler.latest[key]; ok {
+			sampler.window[i] = sampled{sequence: sampler.sequence, message: message}
+			sampler.skipped++
+			return false
+		}
+
+		if sampler.maxRate > 0 && len(sampler.window) >= sampler.maxRate {
+			sampler.skipped++
+			return false
+		}
+
+		sampler.latest[key] = len(sampler.window)
+		sampler.window = append(sampler.window, sampled{sequence: sampler.sequence, message: message})
+		return false
+
+	default:
+		return sampler.admit()
+	}
+}
+
+func (sampler *sampler) admit() bool {
+	if sampler.maxRate > 0 && sampler.passed >= int64(sampler.maxRate) {
+		sampler.skipped++
+		return false
+	}
+
+	sampler.passed++
+	return true
+}
+
+// flush ends the window. It returns the kept messages in the order they came and the report of the window.
+func (sampler *sampler) flush() ([]store.Message, samplingReport) {
+	sort.Slice(sampler.window, func(i, j int) bool { return sampler.window[i].sequence < sampler.window[j].sequence })
+
+	messages := make([]store.Message, 0, len(sampler.window))
+	for _, item := range sampler.window {
+		messages = append(messages, item.message)
+	}
+
+	sampler.totalSkipped += sampler.skipped
+	report := samplingReport{
+		Mode:         sampler.mode,
+		MaxRate:      sampler.maxRate,
+		Passed:       sampler.passed + int64(len(messages)),
+		Skipped:      sampler.skipped,
+		TotalSkipped: sampler.totalSkipped,
+	}
+
+	sampler.passed, sampler.skipped, sampler.window = 0, 0, sampler.window[:0]
+	for key := range sampler.latest {
+		delete(sampler.latest, key)
+	}
+	return messages, report
+}
@@ -0,0 +1,184 @@
+package ws
+
+import (
+	"testing"
+
+	"backend/store"
+)
+
+func TestNewSampler(t *testing.T) {
+	tests := []struct {
+		name    string
+		request MessageRequest
+		sampler bool
+		err     error
+	}{
+		{name: "unlimited", request: MessageRequest{}},
+		{name: "rate", request: MessageRequest{MaxRate: 5}, sampler: true},
+		{name: "nth", request: MessageRequest{Sampling: "nth", SampleEvery: 3}, sampler: true},
+		{name: "nth without every", request: MessageRequest{Sampling: "nth", SampleEvery: 1}, err: errSampleEvery},
+		{name: "reservoir", request: MessageRequest{Sampling: "reservoir", MaxRate: 5}, sampler: true},
+		{name: "reservoir without rate", request: MessageRequest{Sampling: "reservoir"}, err: errReservoirMaxRate},
+		{name: "latest per key", request: MessageRequest{Sampling: "latestPerKey"}, sampler: true},
+		{name: "unknown", request: MessageRequest{Sampling: "first"}, err: errUnknownSampling},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			current, err := newSampler(test.request)
+			if err != test.err {
+				t.Fatalf("error: got %v, want %v", err, test.err)
+			}
+
+			if (current != nil) != test.sampler {
+				t.Errorf("sampler: got %v, want %t", current, test.sampler)
+			}
+		})
+	}
+}
+
+func TestSampler(t *testing.T) {
+	tests := []struct {
+		name    string
+		request MessageRequest
+		keys    string
+		// sent are the offsets sent by offer, flushed are the offsets sent at the end of the window
+		sent    []int
+		flushed []int
+		skipped int64
+	}{
+		{
+			name:    "first of the second",
+			request: MessageRequest{MaxRate: 3},
+			keys:    "abcdefgh",
+			sent:    []int{0, 1, 2},
+			skipped: 5,
+		},
+		{
+			name:    "nth",
+			request: MessageRequest{Sampling: "nth", SampleEvery: 3},
+			keys:    "abcdefghi",
+			sent:    []int{2, 5, 8},
+			skipped: 6,
+		},
+		{
+			name:    "nth with rate",
+			request: MessageRequest{Sampling: "nth", SampleEvery: 2, MaxRate: 2},
+			keys:    "abcdefgh",
+			sent:    []int{1, 3},
+			skipped: 6,
+		},
+		{
+			name:    "latest per key",
+			request: MessageRequest{Sampling: "latestPerKey"},
+			keys:    "abacbd",
+			flushed: []int{2, 3, 4, 5},
+			skipped: 2,
+		},
+		{
+			name:    "latest per key with rate",
+			request: MessageRequest{Sampling: "latestPerKey", MaxRate: 2},
+			keys:    "abacbd",
+			flushed: []int{2, 4},
+			skipped: 4,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			current, err := newSampler(test.request)
+			if err != nil {
+				t.Fatalf("new sampler: %s", err.Error())
+			}
+
+			var sent []int
+			for offset, key := range test.keys {
+				if current.offer(store.Message{Offset: offset, Key: []byte(string(key))}) {
+					sent = append(sent, offset)
+				}
+			}
+			assertOffsets(t, "sent", sent, test.sent)
+
+			messages, report := current.flush()
+			var flushed []int
+			for _, message := range messages {
+				flushed = append(flushed, message.Offset)
+			}
+			assertOffsets(t, "flushed", flushed, test.flushed)
+
+			if report.Skipped != test.skipped || report.TotalSkipped != test.skipped {
+				t.Errorf("skipped: got %d, total %d, want %d", report.Skipped, report.TotalSkipped, test.skipped)
+			}
+
+			if passed := int64(len(test.sent) + len(test.flushed)); report.Passed != passed {
+				t.Errorf("passed: got %d, want %d", report.Passed, passed)
+			}
+
+			if report.Passed+report.Skipped != int64(len(test.keys)) {
+				t.Errorf("report %+v does not count %d messages", report, len(test.keys))
+			}
+		})
+	}
+}
+
+func TestSamplerReservoir(t *testing.T) {
+	current, err := newSampler(MessageRequest{Sampling: "reservoir", MaxRate: 3})
+	if err != nil {
+		t.Fatalf("new sampler: %s", err.Error())
+	}
+
+	for window := 1; window <= 2; window++ {
+		for offset := 0; offset < 10; offset++ {
+			if current.offer(store.Message{Offset: offset}) {
+				t.Fatalf("offset %d is sent before the end of the window", offset)
+			}
+		}
+
+		messages, report := current.flush()
+		if len(messages) != 3 {
+			t.Fatalf("window %d: got %d messages, want 3", window, len(messages))
+		}
+
+		for i := 1; i < len(messages); i++ {
+			if messages[i-1].Offset >= messages[i].Offset {
+				t.Errorf("window %d: messages are not in order: %d, %d", window, messages[i-1].Offset, messages[i].Offset)
+			}
+		}
+
+		if report.Passed != 3 || report.Skipped != 7 || report.TotalSkipped != int64(7*window) {
+			t.Errorf("window %d: got report %+v", window, report)
+		}
+	}
+}
+
+func TestSamplerWindow(t *testing.T) {
+	current, err := newSampler(MessageRequest{MaxRate: 1})
+	if err != nil {
+		t.Fatalf("new sampler: %s", err.Error())
+	}
+
+	if !current.offer(store.Message{Offset: 1}) || current.offer(store.Message{Offset: 2}) {
+		t.Fatal("first window: only the first message is sent")
+	}
+
+	current.flush()
+	if !current.offer(store.Message{Offset: 3}) {
+		t.Fatal("second window: the first message is not sent")
+	}
+}
+
+func assertOffsets(t *testing.T, name string, got []int, want []int) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Errorf("%s: got %v, want %v", name, got, want)
+		return
+	}
+
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+			return
+		}
+	}
+}
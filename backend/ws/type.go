@@ -1,9 +1,25 @@
 package ws
 
+import "time"
+
 //go:generate go-enum -f=$GOFILE --marshal
 //ENUM(
 //topics
 //messages
+//topicInfo
+//consumerGroups
+//createTopic
+//deleteTopic
+//topicConfig
+//alterTopicConfig
+//createPartitions
+//resetOffsets
+//storeUsage
+//search
+//export
+//replay
+//trace
+//stats
 //)
 type WsCommandType uint
 
@@ -23,6 +39,16 @@ type OperatorType uint
 //)
 type CastType uint
 
+//ENUM(
+//unset
+//earliest
+//latest
+//timestamp
+//offset
+//shift
+//)
+type ResetMode uint
+
 type Filter struct {
 	Param    string       `json:"parameter"`
 	Operator OperatorType `json:"operator"`
@@ -32,23 +58,372 @@ type Filter struct {
 type MessageRequest struct {
 	Command WsCommandType `json:"request"`
 	Filters []Filter      `json:"filters,omitempty"`
+	Topic   string        `json:"topic,omitempty"`
+	Group   string        `json:"group,omitempty"`
+
+	Partitions        int               `json:"partitions,omitempty"`
+	ReplicationFactor int               `json:"replicationFactor,omitempty"`
+	Configs           map[string]string `json:"configs,omitempty"`
+	// Confirm must repeat the topic name (the group name for resetOffsets) for the actions which change the cluster
+	Confirm string `json:"confirm,omitempty"`
+
+	ResetMode       ResetMode `json:"mode,omitempty"`
+	ResetPartitions []int32   `json:"resetPartitions,omitempty"`
+	Timestamp       int64     `json:"timestamp,omitempty"`
+	Offset          int64     `json:"offset,omitempty"`
+	DryRun          bool      `json:"dryRun,omitempty"`
+
+	// Query searches the text, From and To bound the message time in milliseconds
+	Query string `json:"query,omitempty"`
+	From  int64  `json:"from,omitempty"`
+	To    int64  `json:"to,omitempty"`
+	Limit int    `json:"limit,omitempty"`
+
+	// Format is jsonl, csv or bundle, Columns select the csv columns
+	Format  string   `json:"format,omitempty"`
+	Columns []string `json:"columns,omitempty"`
+
+	// TargetTopic receives the replayed messages, the confirm must repeat it (the source topic without the target)
+	TargetTopic       string            `json:"targetTopic,omitempty"`
+	Key               *string           `json:"key,omitempty"`
+	DropKey           bool              `json:"dropKey,omitempty"`
+	Headers           map[string]string `json:"headers,omitempty"`
+	DropHeaders       bool              `json:"dropHeaders,omitempty"`
+	PreservePartition bool              `json:"preservePartition,omitempty"`
+	PreserveTimestamp bool              `json:"preserveTimestamp,omitempty"`
+	Rate              int               `json:"rate,omitempty"`
+
+	CorrelationID string `json:"correlationId,omitempty"`
+
+	// Resolution is 1m, 1h or 1d, ByPartition splits the stats by partitions
+	Resolution  string `json:"resolution,omitempty"`
+	ByPartition bool   `json:"byPartition,omitempty"`
+
+	// MaxRate limits the live messages per second, Sampling is nth, reservoir or latestPerKey
+	MaxRate     int    `json:"maxRate,omitempty"`
+	Sampling    string `json:"sampling,omitempty"`
+	SampleEvery int    `json:"sampleEvery,omitempty"`
+
+	// Raw adds the base64 of the consumed value to the messages, the value is downloaded from /api/messages/raw otherwise
+	Raw bool `json:"raw,omitempty"`
+}
+
+type Header struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	// Encoding of the value: utf8, base64 or hex for binary values
+	Encoding string `json:"encoding"`
 }
 
 type Message struct {
-	Topic       string                 `json:"topic"`
-	Headers     map[string]string      `json:"headers"`
-	Offset      string                 `json:"offset"`
-	Partition   string                 `json:"partition"`
-	Timestamp   string                 `json:"timestamp"`
-	At          string                 `json:"at"`
-	PayloadSize string                 `json:"payloadSize"`
-	Payload     map[string]interface{} `json:"payload"`
+	Topic       string      `json:"topic"`
+	Headers     []Header    `json:"headers"`
+	Offset      string      `json:"offset"`
+	Partition   string      `json:"partition"`
+	Timestamp   string      `json:"timestamp"`
+	At          string      `json:"at"`
+	PayloadSize string      `json:"payloadSize"`
+	Payload     interface{} `json:"payload"`
+	// PayloadEncoding is the codec which rendered the payload
+	PayloadEncoding string `json:"payloadEncoding"`
+	// Raw is the base64 of the message value as it was consumed, only when the messages command asks for it
+	Raw         string `json:"raw,omitempty"`
+	SchemaID    int    `json:"schemaId,omitempty"`
+	Subject     string `json:"subject,omitempty"`
+	DecodeError string `json:"decodeError,omitempty"`
 }
 
 type Topic struct {
-	Topic Message `json:"topic"`
+	Topic   Message `json:"topic"`
+	Deleted bool    `json:"deleted,omitempty"`
 }
 
 type Messages struct {
 	Message Message `json:"message"`
 }
+
+type PartitionInfo struct {
+	Partition    int32   `json:"partition"`
+	Leader       int32   `json:"leader"`
+	Replicas     []int32 `json:"replicas"`
+	Isr          []int32 `json:"isr"`
+	Low          int64   `json:"low"`
+	High         int64   `json:"high"`
+	StoredOffset int64   `json:"storedOffset"`
+	StoreLag     int64   `json:"storeLag"`
+}
+
+type TopicInfo struct {
+	Topic      string          `json:"topic"`
+	Partitions []PartitionInfo `json:"partitions"`
+}
+
+type TopicInfos struct {
+	TopicInfo []TopicInfo `json:"topicInfo"`
+}
+
+type GroupMember struct {
+	MemberID    string             `json:"memberId"`
+	ClientID    string             `json:"clientId"`
+	ClientHost  string             `json:"clientHost"`
+	Assignments map[string][]int32 `json:"assignments"`
+}
+
+type GroupOffset struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Committed int64  `json:"committed"`
+	High      int64  `json:"high"`
+	Lag       int64  `json:"lag"`
+}
+
+type ConsumerGroup struct {
+	GroupID  string        `json:"groupId"`
+	State    string        `json:"state"`
+	Protocol string        `json:"protocol"`
+	Members  []GroupMember `json:"members"`
+	Offsets  []GroupOffset `json:"offsets"`
+	TotalLag int64         `json:"totalLag"`
+}
+
+type ConsumerGroups struct {
+	ConsumerGroups []ConsumerGroup `json:"consumerGroups"`
+}
+
+type TopicConfigEntry struct {
+	Name        string `json:"name"`
+	Value       string `json:"value"`
+	Source      string `json:"source"`
+	IsDefault   bool   `json:"isDefault"`
+	IsReadOnly  bool   `json:"isReadOnly"`
+	IsSensitive bool   `json:"isSensitive"`
+}
+
+type TopicConfig struct {
+	Topic   string             `json:"topic"`
+	Configs []TopicConfigEntry `json:"configs"`
+}
+
+type TopicConfigs struct {
+	TopicConfig TopicConfig `json:"topicConfig"`
+}
+
+type AdminResult struct {
+	Action WsCommandType `json:"action"`
+	Topic  string        `json:"topic"`
+	Status string        `json:"status"`
+}
+
+type AdminResults struct {
+	Admin AdminResult `json:"admin"`
+}
+
+type OffsetReset struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Current   int64  `json:"current"`
+	Target    int64  `json:"target"`
+}
+
+type OffsetsReset struct {
+	Group   string        `json:"group"`
+	DryRun  bool          `json:"dryRun"`
+	Offsets []OffsetReset `json:"offsets"`
+}
+
+type OffsetsResets struct {
+	OffsetsReset OffsetsReset `json:"offsetsReset"`
+}
+
+type TopicUsage struct {
+	Topic    string    `json:"topic"`
+	Messages int64     `json:"messages"`
+	Bytes    int64     `json:"bytes"`
+	Oldest   time.Time `json:"oldest"`
+	Newest   time.Time `json:"newest"`
+}
+
+type StoreUsage struct {
+	Topics   []TopicUsage `json:"topics"`
+	Messages int64        `json:"messages"`
+	Bytes    int64        `json:"bytes"`
+}
+
+type StoreUsages struct {
+	StoreUsage StoreUsage `json:"storeUsage"`
+}
+
+type IngestMetrics struct {
+	Consumed      int64 `json:"consumed"`
+	Stored        int64 `json:"stored"`
+	Failed        int64 `json:"failed"`
+	Batches       int64 `json:"batches"`
+	QueueDepth    int   `json:"queueDepth"`
+	QueueCapacity int   `json:"queueCapacity"`
+	Paused        bool  `json:"paused"`
+	StoredPerSec  int64 `json:"storedPerSec"`
+}
+
+type Ingest struct {
+	Ingest IngestMetrics `json:"ingest"`
+}
+
+type SearchResult struct {
+	Topic     string    `json:"topic"`
+	Partition int       `json:"partition"`
+	Offset    int       `json:"offset"`
+	At        time.Time `json:"at"`
+	Field     string    `json:"field"`
+	Snippet   string    `json:"snippet"`
+}
+
+type SearchResults struct {
+	Query           string         `json:"query"`
+	Results         []SearchResult `json:"results"`
+	IndexedFrom     time.Time      `json:"indexedFrom"`
+	IndexedTo       time.Time      `json:"indexedTo"`
+	Indexed         int            `json:"indexed"`
+	Loading         bool           `json:"loading"`
+	SkippedBatches  int64          `json:"skippedBatches"`
+	SkippedMessages int64          `json:"skippedMessages"`
+	Note            string         `json:"note"`
+}
+
+type Searches struct {
+	Search SearchResults `json:"search"`
+}
+
+type ExportLink struct {
+	Format string `json:"format"`
+	URL    string `json:"url"`
+}
+
+type Exports struct {
+	Export ExportLink `json:"export"`
+}
+
+type ReplayProgress struct {
+	ID       string `json:"id"`
+	Read     int64  `json:"read"`
+	Produced int64  `json:"produced"`
+	Failed   int64  `json:"failed"`
+	DryRun   bool   `json:"dryRun"`
+	Done     bool   `json:"done"`
+	Error    string `json:"error,omitempty"`
+}
+
+type Replays struct {
+	Replay ReplayProgress `json:"replay"`
+}
+
+type TraceStep struct {
+	Topic      string    `json:"topic"`
+	Partition  int       `json:"partition"`
+	Offset     int       `json:"offset"`
+	At         time.Time `json:"at"`
+	GapMs      int64     `json:"gapMs"`
+	Expected   int       `json:"expected"`
+	OutOfOrder bool      `json:"outOfOrder"`
+}
+
+type Trace struct {
+	CorrelationID string      `json:"correlationId"`
+	Steps         []TraceStep `json:"steps"`
+	Missing       []string    `json:"missing"`
+	DurationMs    int64       `json:"durationMs"`
+	Since         time.Time   `json:"since"`
+	Undecoded     int64       `json:"undecoded"`
+	Note          string      `json:"note"`
+}
+
+type Traces struct {
+	Trace Trace `json:"trace"`
+}
+
+type StatsBucket struct {
+	Start   time.Time `json:"start"`
+	Count   int64     `json:"count"`
+	Bytes   int64     `json:"bytes"`
+	MinSize int       `json:"minSize"`
+	AvgSize int64     `json:"avgSize"`
+	MaxSize int       `json:"maxSize"`
+}
+
+type StatsSeries struct {
+	Topic       string        `json:"topic"`
+	Partition   int           `json:"partition"`
+	LastMessage time.Time     `json:"lastMessage"`
+	Buckets     []StatsBucket `json:"buckets"`
+}
+
+type TopicStats struct {
+	Resolution string        `json:"resolution"`
+	Series     []StatsSeries `json:"series"`
+}
+
+type Stats struct {
+	Stats TopicStats `json:"stats"`
+}
+
+type ComponentHealth struct {
+	Name  string    `json:"name"`
+	Up    bool      `json:"up"`
+	Error string    `json:"error,omitempty"`
+	Since time.Time `json:"since"`
+}
+
+type Health struct {
+	Status     string            `json:"status"`
+	Components []ComponentHealth `json:"components"`
+	Lag        int64             `json:"lag"`
+	Ingest     IngestMetrics     `json:"ingest"`
+}
+
+type Connection struct {
+	ID            string            `json:"id"`
+	RemoteAddr    string            `json:"remoteAddr"`
+	User          string            `json:"user"`
+	ConnectedAt   time.Time         `json:"connectedAt"`
+	LastActivity  time.Time         `json:"lastActivity"`
+	IdleMs        int64             `json:"idleMs"`
+	BytesSent     int64             `json:"bytesSent"`
+	Queued        int               `json:"queued"`
+	Dropped       int64             `json:"dropped"`
+	Subscriptions map[string]string `json:"subscriptions"`
+}
+
+type LaggingInfo struct {
+	Dropped   int64  `json:"dropped"`
+	Policy    string `json:"policy"`
+	QueueSize int    `json:"queueSize"`
+	// Source is changeFeed for the messages dropped by the change feed, empty for the socket queue
+	Source string `json:"source,omitempty"`
+}
+
+type Lagging struct {
+	Lagging LaggingInfo `json:"lagging"`
+}
+
+type SamplingInfo struct {
+	Mode         string `json:"mode"`
+	MaxRate      int    `json:"maxRate"`
+	Passed       int64  `json:"passed"`
+	Skipped      int64  `json:"skipped"`
+	TotalSkipped int64  `json:"totalSkipped"`
+}
+
+type Sampling struct {
+	Sampling SamplingInfo `json:"sampling"`
+}
+
+type Connections struct {
+	Connections []Connection `json:"connections"`
+}
+
+type ClosedConnections struct {
+	Closed []string `json:"closed"`
+}
+
+type Error struct {
+	Error string `json:"error"`
+}
@@ -3,42 +3,133 @@ package ws
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net"
 	"net/http"
+	"sync"
 	"time"
 
 	"backend/config"
+	"backend/decoder"
+	"backend/health"
+	"backend/ingest"
+	"backend/metrics"
+	"backend/provider"
+	"backend/search"
+	"backend/stats"
 	"backend/store"
+	"backend/trace"
 
 	"github.com/gobwas/ws"
 	"github.com/gobwas/ws/wsutil"
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	shutdownReason     = "server is shutting down"
+	kickReason         = "closed by the administrator"
+	slowConsumerReason = "outbound queue is full"
+	allSubscription    = "*"
+)
+
+var (
+	errSocketClosed  = errors.New("socket is closed")
+	errSlowConsumer  = errors.New("socket is disconnected as a slow consumer")
+	errTopicRequired = errors.New("topic is required")
+	errGroupRequired = errors.New("group is required")
+	errNotConfirmed  = errors.New("action is not confirmed: repeat the topic or group name in the confirm field")
+)
+
 type Service interface {
 	Serve()
-	Stop()
+	Stop(ctx context.Context)
 }
 
 type WsService struct {
 	configure   *config.Configure     `di.inject:"appConfigure"`
 	storeSvc    *store.RethinkService `di.inject:"storeService"`
-	connections map[uuid.UUID]net.Conn
+	providerSvc *provider.Provider    `di.inject:"providerService"`
+	adminSvc    *provider.Admin       `di.inject:"adminService"`
+	decoderSvc  *decoder.Decoder      `di.inject:"decoderService"`
+	searchSvc   *search.Search        `di.inject:"searchService"`
+	traceSvc    *trace.Tracer         `di.inject:"traceService"`
+	statsSvc    *stats.Stats          `di.inject:"statsService"`
+	healthSvc   *health.Health        `di.inject:"health"`
+	ingestSvc   *ingest.Metrics       `di.inject:"ingestMetrics"`
+	server      *http.Server
+	registry    *registry
+	overflow    OverflowPolicy
 }
 
 func (wsService *WsService) Serve() {
-	wsService.connections = make(map[uuid.UUID]net.Conn)
+	var config = wsService.configure.Config
+	wsService.registry = newRegistry(config.WsMaxConnections, config.WsMaxUserConnections)
+
+	var ok bool
+	if wsService.overflow, ok = ParseOverflowPolicy(config.WsOverflowPolicy); !ok {
+		log.Warnf("Unknown socket overflow policy '%s', use '%s'", config.WsOverflowPolicy, wsService.overflow)
+	}
 
+	http.HandleFunc("/api/topic-info", wsService.TopicInfo)
+	http.HandleFunc("/api/consumer-groups", wsService.ConsumerGroups)
+	http.HandleFunc("/api/consumer-groups/offsets", wsService.GroupOffsets)
+	http.HandleFunc("/api/topics", wsService.Topics)
+	http.HandleFunc("/api/topics/config", wsService.TopicConfig)
+	http.HandleFunc("/api/topics/partitions", wsService.TopicPartitions)
+	http.HandleFunc("/api/messages/raw", wsService.RawMessage)
+	http.HandleFunc("/api/store/usage", wsService.StoreUsage)
+	http.HandleFunc("/api/ingest/metrics", wsService.IngestMetrics)
+	http.HandleFunc("/api/search", wsService.Search)
+	http.HandleFunc(exportPath, wsService.Export)
+	http.HandleFunc("/api/replay", wsService.Replay)
+	http.HandleFunc("/api/trace", wsService.Trace)
+	http.HandleFunc("/api/stats", wsService.Stats)
+	http.HandleFunc("/api/replay/import", wsService.ReplayImport)
+	http.HandleFunc("/api/connections", wsService.Connections)
+	http.Handle("/metrics", promhttp.Handler())
+	http.HandleFunc("/healthz", wsService.Healthz)
+	http.HandleFunc("/readyz", wsService.Readyz)
 	http.HandleFunc("/", wsService.Socket)
-	go log.Fatal(http.ListenAndServe(":9002", nil))
+
+	wsService.server = &http.Server{Addr: ":" + config.WebSocketPort}
+	go func() {
+		if err := wsService.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Http server error: %s", err.Error())
+		}
+	}()
 }
 
-func (wsService *WsService) Stop() {
+// Stop sends the close frame to the sockets and waits for the active requests, e.g. exports, to complete.
+func (wsService *WsService) Stop(ctx context.Context) {
 	log.Info("Terminate socket")
 
-	for id := range wsService.connections {
-		wsService.closeSocket(id)
+	// the close frames are sent in parallel, the sockets which don't take them before the deadline are closed
+	closed := make(chan struct{})
+	go func() {
+		var group sync.WaitGroup
+		for _, current := range wsService.registry.all() {
+			group.Add(1)
+			go func(id uuid.UUID) {
+				defer group.Done()
+				wsService.closeSocketWithReason(id, ws.StatusGoingAway, shutdownReason)
+			}(current.id)
+		}
+		group.Wait()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-ctx.Done():
+		for _, current := range wsService.registry.all() {
+			wsService.closeSocket(current.id)
+		}
+	}
+
+	if err := wsService.server.Shutdown(ctx); err != nil {
+		log.Warnf("Http server shutdown error: %s", err.Error())
 	}
 }
 
@@ -68,27 +159,85 @@ func (wsService *WsService) initConnection(writer http.ResponseWriter, request *
 		return uuid.UUID{}, err
 	}
 
-	id := uuid.New()
-	log.Infof("Create '%s' connection", id.String())
+	outbox := newOutbox(wsService.configure.Config.WsOutboundQueueSize, wsService.overflow)
+	current := newConnection(conn, request.RemoteAddr, wsService.user(request), outbox)
+	if err = wsService.registry.add(current); err != nil {
+		_ = current.write(ws.OpClose, ws.NewCloseFrameBody(ws.StatusPolicyViolation, err.Error()))
+		_ = conn.Close()
+		return uuid.UUID{}, err
+	}
 
-	wsService.connections[id] = conn
-	return id, nil
+	log.Infof("Create '%s' connection of '%s'", current.id.String(), current.user)
+	metrics.Sockets.Inc()
+
+	go wsService.serveOutbox(current)
+	return current.id, nil
+}
+
+// serveOutbox writes the queued messages to the socket. The client is notified with the lagging message before the
+// next messages when some of the live messages were dropped.
+func (wsService *WsService) serveOutbox(current *connection) {
+	var outbox = current.outbox
+
+	for {
+		select {
+		case <-outbox.done:
+			return
+		case <-outbox.ready:
+		}
+
+		messages, dropped := outbox.take()
+		if dropped > 0 {
+			log.Debugf("WsSocket: '%s' is lagging, %d messages are dropped", current.id, dropped)
+			metrics.SocketDroppedMessages.Add(float64(dropped))
+			lagging := outbound{payload: toJson(ConvertToWsLagging(dropped, outbox.policy, outbox.capacity))}
+			messages = append([]outbound{lagging}, messages...)
+		}
+
+		for _, message := range messages {
+			if err := current.write(ws.OpText, message.payload); err != nil {
+				log.Errorf("WsSocket: failed to write message to '%s'. Err: %s", current.id, err.Error())
+				wsService.closeSocket(current.id)
+				return
+			}
+			metrics.SocketMessages.WithLabelValues("out").Inc()
+		}
+	}
+}
+
+// user identifies the user of the socket by the user header set by the trusted proxy, or by the remote host without it.
+// The header is opt-in, a client which reaches the backend directly sets any header it likes.
+func (wsService *WsService) user(request *http.Request) string {
+	if header := wsService.configure.Config.WsUserHeader; header != "" {
+		if user := request.Header.Get(header); user != "" {
+			return user
+		}
+	}
+
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
 }
 
 func (wsService *WsService) handleInput(id uuid.UUID, socketCancel context.CancelFunc) <-chan MessageRequest {
-	var (
-		wsCommandChan = make(chan MessageRequest)
-		request       MessageRequest
-	)
+	var wsCommandChan = make(chan MessageRequest)
 
 	go func() {
+		current, ok := wsService.connection(id)
+		if !ok {
+			socketCancel()
+			return
+		}
+
 		for {
 			select {
 			case <-wsService.configure.GlobalContext.Done():
 				close(wsCommandChan)
 				return
 			default:
-				msg, opCode, _ := wsutil.ReadClientData(wsService.connections[id])
+				msg, opCode, _ := wsutil.ReadClientData(current.conn)
 				log.Tracef("Get msg from client '%s': %s", id, string(msg))
 
 				if opCode == ws.OpClose || opCode == ws.OpContinuation {
@@ -102,7 +251,15 @@ func (wsService *WsService) handleInput(id uuid.UUID, socketCancel context.Cance
 					continue
 				}
 
-				_ = json.Unmarshal(msg, &request)
+				metrics.SocketMessages.WithLabelValues("in").Inc()
+
+				// every command starts from the zero request, fields of the previous commands must not leak into it
+				var request MessageRequest
+				if err := json.Unmarshal(msg, &request); err != nil {
+					log.Warnf("Invalid command from '%s': %s", id, err.Error())
+					continue
+				}
+				current.touch()
 				wsCommandChan <- request
 			}
 		}
@@ -114,11 +271,22 @@ func (wsService *WsService) handleInput(id uuid.UUID, socketCancel context.Cance
 func (wsService *WsService) handleOutput(id uuid.UUID, wsCmdReqChan <-chan MessageRequest, wsSocketContext context.Context) {
 	go func() {
 		timeTick := time.Tick(30 * time.Second)
+		sampleTick := time.NewTicker(time.Second)
+		defer sampleTick.Stop()
+		var (
+			messageSampler *sampler
+			// withRaw adds the base64 of the consumed values to the messages of the messages command
+			withRaw bool
+		)
+
 		startTopicChan := make(chan interface{}, 1)
 		filterChan := make(chan store.Filters, 1)
+		groupChan := make(chan string, 1)
+		replayChan := make(chan provider.ReplayProgress, 1)
 
 		wsMsgChan := wsService.storeSvc.Messages(wsSocketContext, filterChan)
 		wsTopicChan := wsService.storeSvc.Topics(wsSocketContext, startTopicChan)
+		wsGroupsChan := wsService.adminSvc.WatchConsumerGroups(wsSocketContext, groupChan)
 		defer wsService.closeSocket(id)
 
 		for {
@@ -131,7 +299,7 @@ func (wsService *WsService) handleOutput(id uuid.UUID, wsCmdReqChan <-chan Messa
 
 			case <-timeTick:
 				log.Tracef("Ping connection: %s", id)
-				if err := wsutil.WriteServerMessage(wsService.connections[id], ws.OpPing, []byte("{}")); err != nil {
+				if err := wsService.send(id, ws.OpPing, []byte("{}")); err != nil {
 					log.Errorf("WsSocket: failed to write message to '%s'. Err: %s", id, err.Error())
 					return
 				}
@@ -143,11 +311,43 @@ func (wsService *WsService) handleOutput(id uuid.UUID, wsCmdReqChan <-chan Messa
 				}
 
 				log.Debugf("Get message from channel: %s", toJson(message))
-				if err := wsutil.WriteServerMessage(wsService.connections[id], ws.OpText, toJson(ConvertToWsMessage(message))); err != nil {
+				if message.Dropped > 0 {
+					if err := wsService.write(id, toJson(ConvertToWsFeedLagging(message.Dropped))); err != nil {
+						log.Errorf("WsSocket: failed to write message to '%s'. Err: %s", id, err.Error())
+						return
+					}
+				}
+
+				// the sampler limits only the live messages, the history of the subscription is sent as a whole
+				if messageSampler != nil && !message.History && !messageSampler.offer(message.Message) {
+					continue
+				}
+
+				if err := wsService.streamMessage(id, message.Message, withRaw); err != nil {
 					log.Errorf("WsSocket: failed to write message to '%s'. Err: %s", id, err.Error())
 					return
 				}
 
+			case <-sampleTick.C:
+				if messageSampler == nil {
+					continue
+				}
+
+				messages, report := messageSampler.flush()
+				for _, message := range messages {
+					if err := wsService.streamMessage(id, message, withRaw); err != nil {
+						log.Errorf("WsSocket: failed to write message to '%s'. Err: %s", id, err.Error())
+						return
+					}
+				}
+
+				if report.Skipped > 0 {
+					if err := wsService.write(id, toJson(ConvertToWsSampling(report))); err != nil {
+						log.Errorf("WsSocket: failed to write message to '%s'. Err: %s", id, err.Error())
+						return
+					}
+				}
+
 			case msg, ok := <-wsTopicChan:
 				if !ok {
 					log.Debug("Topic channel was closed")
@@ -155,7 +355,24 @@ func (wsService *WsService) handleOutput(id uuid.UUID, wsCmdReqChan <-chan Messa
 				}
 
 				log.Debugf("Get topics from channel: %s", toJson(msg))
-				if err := wsutil.WriteServerMessage(wsService.connections[id], ws.OpText, toJson(ConvertToWsTopic(msg))); err != nil {
+				if err := wsService.stream(id, "", toJson(ConvertToWsTopic(msg))); err != nil {
+					log.Errorf("WsSocket: failed to write message to '%s'. Err: %s", id, err.Error())
+					return
+				}
+
+			case groups, ok := <-wsGroupsChan:
+				if !ok {
+					log.Debug("Consumer groups channel was closed")
+					return
+				}
+
+				if err := wsService.stream(id, WsCommandTypeConsumerGroups.String(), toJson(ConvertToWsConsumerGroups(groups))); err != nil {
+					log.Errorf("WsSocket: failed to write message to '%s'. Err: %s", id, err.Error())
+					return
+				}
+
+			case progress := <-replayChan:
+				if err := wsService.stream(id, WsCommandTypeReplay.String(), toJson(ConvertToWsReplay(progress))); err != nil {
 					log.Errorf("WsSocket: failed to write message to '%s'. Err: %s", id, err.Error())
 					return
 				}
@@ -165,16 +382,126 @@ func (wsService *WsService) handleOutput(id uuid.UUID, wsCmdReqChan <-chan Messa
 					log.Debug("Ws Command Request channel was closed")
 					return
 				}
-				log.Debugf("Ws Command Request channel has msg: %s", cmd)
+				log.Debugf("Ws Command Request channel has msg: %v", cmd)
 
 				switch cmd.Command {
 				case WsCommandTypeTopics:
 					log.Debug("Get topics")
+					wsService.subscribe(id, cmd.Command, "")
 					startTopicChan <- 0
 				case WsCommandTypeMessages:
-					storeFilter := ConvertToStoreFilter(cmd)
+					current, err := newSampler(cmd)
+					if err != nil {
+						log.Warnf("Messages sampling error: %s", err.Error())
+						if err = wsService.write(id, toJson(Error{Error: err.Error()})); err != nil {
+							log.Errorf("WsSocket: failed to write message to '%s'. Err: %s", id, err.Error())
+							return
+						}
+						continue
+					}
+					messageSampler, withRaw = current, cmd.Raw
+
+					storeFilter := ConvertToStoreFilter(cmd, wsService.decoderSvc, wsService.configure.Config.HeaderBinaryEncoding)
 					log.Debugf("Get filters: %v", storeFilter)
+					wsService.subscribe(id, cmd.Command, storeFilter.Topic)
 					filterChan <- storeFilter
+				case WsCommandTypeTopicInfo:
+					log.Debugf("Get topic info: %s", cmd.Topic)
+					var response interface{}
+					if infos, err := wsService.topicInfos(cmd.Topic); err != nil {
+						log.Warnf("Topic info error: %s", err.Error())
+						response = Error{Error: err.Error()}
+					} else {
+						response = TopicInfos{TopicInfo: infos}
+					}
+
+					if err := wsService.write(id, toJson(response)); err != nil {
+						log.Errorf("WsSocket: failed to write message to '%s'. Err: %s", id, err.Error())
+						return
+					}
+				case WsCommandTypeStoreUsage:
+					log.Debug("Get store usage")
+					var response interface{}
+					if usage, err := wsService.storeSvc.Usage(); err != nil {
+						log.Warnf("Store usage error: %s", err.Error())
+						response = Error{Error: err.Error()}
+					} else {
+						response = ConvertToWsStoreUsage(usage)
+					}
+
+					if err := wsService.write(id, toJson(response)); err != nil {
+						log.Errorf("WsSocket: failed to write message to '%s'. Err: %s", id, err.Error())
+						return
+					}
+				case WsCommandTypeSearch:
+					log.Debugf("Search: %s", cmd.Query)
+					var response interface{}
+					if results, err := wsService.searchSvc.Search(ConvertToSearchQuery(cmd)); err != nil {
+						log.Warnf("Search error: %s", err.Error())
+						response = Error{Error: err.Error()}
+					} else {
+						response = ConvertToWsSearch(cmd.Query, results)
+					}
+
+					if err := wsService.write(id, toJson(response)); err != nil {
+						log.Errorf("WsSocket: failed to write message to '%s'. Err: %s", id, err.Error())
+						return
+					}
+				case WsCommandTypeExport:
+					log.Debugf("Export %s: %v", cmd.Format, cmd.Filters)
+					if err := wsService.write(id, toJson(ConvertToWsExport(cmd))); err != nil {
+						log.Errorf("WsSocket: failed to write message to '%s'. Err: %s", id, err.Error())
+						return
+					}
+				case WsCommandTypeReplay:
+					log.Debugf("Replay to '%s': %v", cmd.TargetTopic, cmd.Filters)
+					go wsService.replay(wsSocketContext, cmd, replayChan)
+				case WsCommandTypeTrace:
+					log.Debugf("Trace: %s", cmd.CorrelationID)
+					var response interface{}
+					if result, err := wsService.traceSvc.Trace(cmd.CorrelationID); err != nil {
+						log.Warnf("Trace error: %s", err.Error())
+						response = Error{Error: err.Error()}
+					} else {
+						response = ConvertToWsTrace(result)
+					}
+
+					if err := wsService.write(id, toJson(response)); err != nil {
+						log.Errorf("WsSocket: failed to write message to '%s'. Err: %s", id, err.Error())
+						return
+					}
+				case WsCommandTypeStats:
+					log.Debugf("Stats: %s %s", cmd.Topic, cmd.Resolution)
+					var response interface{}
+					query := ConvertToStatsQuery(cmd)
+					if series, err := wsService.statsSvc.Stats(query); err != nil {
+						log.Warnf("Stats error: %s", err.Error())
+						response = Error{Error: err.Error()}
+					} else {
+						response = ConvertToWsStats(query, series)
+					}
+
+					if err := wsService.write(id, toJson(response)); err != nil {
+						log.Errorf("WsSocket: failed to write message to '%s'. Err: %s", id, err.Error())
+						return
+					}
+				case WsCommandTypeConsumerGroups:
+					log.Debugf("Watch consumer groups: %s", cmd.Group)
+					wsService.subscribe(id, cmd.Command, cmd.Group)
+					groupChan <- cmd.Group
+				case WsCommandTypeCreateTopic, WsCommandTypeDeleteTopic, WsCommandTypeTopicConfig,
+					WsCommandTypeAlterTopicConfig, WsCommandTypeCreatePartitions, WsCommandTypeResetOffsets:
+					log.Debugf("Admin command %s: %s", cmd.Command, cmd.Topic)
+					response, err := wsService.topicAdmin(cmd)
+					if err != nil {
+						log.Warnf("Admin command %s error: %s", cmd.Command, err.Error())
+						response = Error{Error: err.Error()}
+					}
+
+					if err := wsService.write(id, toJson(response)); err != nil {
+						log.Errorf("WsSocket: failed to write message to '%s'. Err: %s", id, err.Error())
+						return
+					}
 				}
 			}
 		}
@@ -184,10 +511,204 @@ func (wsService *WsService) handleOutput(id uuid.UUID, wsCmdReqChan <-chan Messa
 func (wsService *WsService) closeSocket(id uuid.UUID) {
 	log.Infof("Close '%s' connection", id)
 
-	if con, ok := wsService.connections[id]; ok {
-		con.Close()
-		delete(wsService.connections, id)
+	if current, ok := wsService.registry.remove(id); ok {
+		current.outbox.close()
+		current.conn.Close()
+		metrics.Sockets.Dec()
+	}
+}
+
+// closeSocketWithReason sends the close frame with the status code and the reason before the socket is closed.
+func (wsService *WsService) closeSocketWithReason(id uuid.UUID, code ws.StatusCode, reason string) {
+	if err := wsService.send(id, ws.OpClose, ws.NewCloseFrameBody(code, reason)); err != nil && err != errSocketClosed {
+		log.Warnf("WsSocket: failed to send close frame to '%s'. Err: %s", id, err.Error())
+	}
+	wsService.closeSocket(id)
+}
+
+// subscribe records the live subscription of the socket, an empty value subscribes on all topics or groups.
+func (wsService *WsService) subscribe(id uuid.UUID, command WsCommandType, value string) {
+	if value == "" {
+		value = allSubscription
 	}
+
+	if current, ok := wsService.connection(id); ok {
+		current.subscribe(command, value)
+	}
+}
+
+func (wsService *WsService) connection(id uuid.UUID) (*connection, bool) {
+	return wsService.registry.get(id)
+}
+
+// write queues the response to the command, it is sent even when the socket is lagging.
+func (wsService *WsService) write(id uuid.UUID, payload []byte) error {
+	return wsService.push(id, outbound{payload: payload})
+}
+
+// stream queues the live message of the subscription, the key coalesces the updates of the same state.
+func (wsService *WsService) stream(id uuid.UUID, key string, payload []byte) error {
+	return wsService.push(id, outbound{payload: payload, live: true, key: key})
+}
+
+func (wsService *WsService) streamMessage(id uuid.UUID, message store.Message, raw bool) error {
+	return wsService.stream(id, "", toJson(ConvertToWsMessage(message, wsService.decoderSvc.Decode(message),
+		wsService.configure.Config.HeaderBinaryEncoding, raw)))
+}
+
+func (wsService *WsService) push(id uuid.UUID, message outbound) error {
+	current, ok := wsService.connection(id)
+	if !ok {
+		return errSocketClosed
+	}
+
+	if !current.outbox.push(message) {
+		// the close frame would wait for the writes of the slow socket, so the socket is closed without it
+		log.Warnf("WsSocket: '%s' %s", id, slowConsumerReason)
+		wsService.closeSocket(id)
+		return errSlowConsumer
+	}
+	return nil
+}
+
+func (wsService *WsService) send(id uuid.UUID, opCode ws.OpCode, payload []byte) error {
+	current, ok := wsService.connection(id)
+	if !ok {
+		return errSocketClosed
+	}
+	return current.write(opCode, payload)
+}
+
+func (wsService *WsService) topicInfos(topic string) ([]TopicInfo, error) {
+	infos, err := wsService.providerSvc.TopicInfo(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]TopicInfo, 0, len(infos))
+	for _, info := range infos {
+		storedOffsets, err := wsService.storeSvc.LastOffsets(info.Topic)
+		if err != nil {
+			log.Warnf("Read stored offsets of '%s' error: %s", info.Topic, err.Error())
+		}
+		result = append(result, ConvertToWsTopicInfo(info, storedOffsets))
+	}
+
+	return result, nil
+}
+
+// replay produces the stored messages which pass the filters of the command and pushes the progress to the socket.
+func (wsService *WsService) replay(socketContext context.Context, cmd MessageRequest, progressChan chan<- provider.ReplayProgress) {
+	var (
+		filters = ConvertToStoreFilter(cmd, wsService.decoderSvc, wsService.configure.Config.HeaderBinaryEncoding)
+		done    bool
+	)
+
+	progress := func(progress provider.ReplayProgress) {
+		done = progress.Done
+		select {
+		case progressChan <- progress:
+		case <-socketContext.Done():
+		}
+	}
+
+	if err := checkReplay(cmd, filters.Topic); err != nil {
+		progress(provider.ReplayProgress{DryRun: cmd.DryRun, Done: true, Error: err.Error()})
+		return
+	}
+
+	err := wsService.adminSvc.Replay(socketContext, ConvertToReplayRequest(cmd), func(fn func(store.Message) error) error {
+		return wsService.storeSvc.Export(socketContext, filters, fn)
+	}, progress)
+	if err != nil {
+		log.Warnf("Replay error: %s", err.Error())
+		if !done {
+			progress(provider.ReplayProgress{DryRun: cmd.DryRun, Done: true, Error: err.Error()})
+		}
+	}
+}
+
+// checkReplay requires the confirm to repeat the topic which receives the messages and a rate within the limit.
+func checkReplay(cmd MessageRequest, sourceTopic string) error {
+	target := cmd.TargetTopic
+	if target == "" {
+		target = sourceTopic
+	}
+
+	if target == "" {
+		return errTopicRequired
+	}
+
+	if cmd.Rate < 0 || cmd.Rate > provider.MaxReplayRate {
+		return provider.ErrReplayRate
+	}
+
+	if !cmd.DryRun && cmd.Confirm != target {
+		return errNotConfirmed
+	}
+	return nil
+}
+
+// topicAdmin executes the administration command. The commands which change the cluster must be confirmed
+// by repeating the topic name, offsets reset - by repeating the group name.
+func (wsService *WsService) topicAdmin(cmd MessageRequest) (interface{}, error) {
+	var err error
+
+	if cmd.Topic == "" {
+		return nil, errTopicRequired
+	}
+
+	if cmd.Command == WsCommandTypeResetOffsets {
+		if cmd.Group == "" {
+			return nil, errGroupRequired
+		}
+
+		if !cmd.DryRun && cmd.Confirm != cmd.Group {
+			return nil, errNotConfirmed
+		}
+
+		resets, err := wsService.adminSvc.ResetOffsets(ConvertToOffsetResetRequest(cmd))
+		if err != nil {
+			return nil, err
+		}
+		return ConvertToWsOffsetsReset(cmd, resets), nil
+	}
+
+	if cmd.Command != WsCommandTypeTopicConfig && cmd.Confirm != cmd.Topic {
+		return nil, errNotConfirmed
+	}
+
+	switch cmd.Command {
+	case WsCommandTypeTopicConfig:
+		entries, err := wsService.adminSvc.TopicConfig(cmd.Topic)
+		if err != nil {
+			return nil, err
+		}
+		return ConvertToWsTopicConfig(cmd.Topic, entries), nil
+
+	case WsCommandTypeCreateTopic:
+		err = wsService.adminSvc.CreateTopic(ConvertToTopicSpec(cmd))
+
+	case WsCommandTypeDeleteTopic:
+		if err = wsService.adminSvc.DeleteTopic(cmd.Topic); err == nil {
+			err = wsService.storeSvc.PurgeTopic(cmd.Topic)
+		}
+
+	case WsCommandTypeAlterTopicConfig:
+		err = wsService.adminSvc.AlterTopicConfig(cmd.Topic, cmd.Configs)
+
+	case WsCommandTypeCreatePartitions:
+		err = wsService.adminSvc.CreatePartitions(cmd.Topic, cmd.Partitions)
+
+	default:
+		err = errors.New("unsupported command")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return AdminResults{Admin: AdminResult{Action: cmd.Command, Topic: cmd.Topic, Status: "ok"}}, nil
 }
 
 func toJson(message interface{}) []byte {
@@ -44,9 +44,13 @@ export default new Vuex.Store({
       console.error(state, event);
     },
     SOCKET_ONMESSAGE(state, message) {
-      message.topic
-        ? this.commit("ADD_TOPIC", message.topic.topic)
-        : this.commit("ADD_MESSAGE", message.message);
+      if (message.topic) {
+        message.deleted
+          ? this.commit("REMOVE_TOPIC", message.topic.topic)
+          : this.commit("ADD_TOPIC", message.topic.topic);
+      } else if (message.message) {
+        this.commit("ADD_MESSAGE", message.message);
+      }
     },
     SET_TOPIC: (state, topic) => {
       state.topic = topic;
@@ -56,6 +60,13 @@ export default new Vuex.Store({
         state.topics.push(topic);
       }
     },
+    REMOVE_TOPIC: (state, topic) => {
+      let index = state.topics.indexOf(topic);
+
+      if (index !== -1) {
+        state.topics.splice(index, 1);
+      }
+    },
     ADD_MESSAGE: (state, message) => {
       if (state.messages.length == state.size) {
         state.messages.pop();